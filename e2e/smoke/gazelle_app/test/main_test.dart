@@ -0,0 +1,8 @@
+import 'package:flutter_test/flutter_test.dart';
+
+void main() {
+  // Minimal test used to exercise flutter_test generation.
+  test('gazelle_app', () {
+    expect(1 + 1, 2);
+  });
+}
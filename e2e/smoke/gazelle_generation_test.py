@@ -54,6 +54,7 @@ def main() -> int:
             "protos/api/v1/service.proto",
             "pub_deps.json",
             "pubspec.yaml",
+            "test/main_test.dart",
         ]
         for rel in fixture_files:
             src = load_runfile(f"gazelle_app/{rel}", workspace)
@@ -1078,7 +1078,7 @@ targets mount each generated file at its proto-import-relative path under the
 destination; other targets mount flat by basename.""",
         ),
         "generator_commands": attr.string_list(
-            doc = "List of one-shot generator commands to run via `dart run` (e.g., ['intl_utils:generate']).",
+            doc = "List of one-shot generator commands: `package:executable` entries run via `dart run` (e.g., ['intl_utils:generate']), and `flutter <subcommand>` entries run the Flutter tool (e.g., ['flutter gen-l10n']).",
             default = [],
         ),
         "build_runner_modes": attr.string_list(
@@ -3399,7 +3399,7 @@ targets mount each generated file at its proto-import-relative path under the
 destination; other targets mount flat by basename.""",
         ),
         "generator_commands": attr.string_list(
-            doc = "List of one-shot generator commands to run via `dart run` (e.g., ['intl_utils:generate']).",
+            doc = "List of one-shot generator commands: `package:executable` entries run via `dart run` (e.g., ['intl_utils:generate']), and `flutter <subcommand>` entries run the Flutter tool (e.g., ['flutter gen-l10n']).",
             default = [],
         ),
         "build_runner_modes": attr.string_list(
@@ -1234,7 +1234,16 @@ if [ ${{#GENERATOR_COMMANDS[@]}} -gt 0 ]; then
         exit 1
     fi
     for CODEGEN_CMD in "${{GENERATOR_COMMANDS[@]}}"; do
-        if [ -n "$CODEGEN_CMD" ]; then
+        if [[ "$CODEGEN_CMD" == "flutter "* ]]; then
+            # Flutter tool subcommands (e.g. `flutter gen-l10n`) run with the
+            # hermetic SDK instead of a package executable.
+            echo "Running code generation: $CODEGEN_CMD"
+            read -ra FLUTTER_ARGS <<< "${{CODEGEN_CMD#flutter }}"
+            if ! "$FLUTTER_BIN_ABS" --suppress-analytics --no-version-check "${{FLUTTER_ARGS[@]}}"; then
+                echo "✗ FATAL ERROR: Generator command '$CODEGEN_CMD' failed" >&2
+                exit 1
+            fi
+        elif [ -n "$CODEGEN_CMD" ]; then
             echo "Running code generation: $CODEGEN_CMD"
             CODEGEN_ENTRYPOINT="$(
                 CODEGEN_CMD="$CODEGEN_CMD" PACKAGE_CONFIG_PATH="$PACKAGE_CONFIG_PATH" "$PYTHON_BIN" <<'PY'
@@ -2,8 +2,10 @@ package dartproto
 
 import (
 	"sort"
+	"strings"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
 	"github.com/bazelbuild/bazel-gazelle/language"
 	"github.com/bazelbuild/bazel-gazelle/resolve"
 	"github.com/bazelbuild/bazel-gazelle/rule"
@@ -14,13 +16,17 @@ import (
 // GenerateRules emits dart_proto_library targets for proto_library rules that already exist.
 func (pl *protoLang) GenerateRules(args language.GenerateArgs) language.GenerateResult {
 	fc := flutter.GetFlutterConfig(args.Config)
-	if !fc.Generate || fc.IsExcluded(args.Rel) {
+	if fc.IsExcluded(args.Rel) {
 		return language.GenerateResult{}
 	}
+	if !fc.Generate {
+		return language.GenerateResult{Empty: emptyRules(args, nil)}
+	}
 
 	protoNames := collectProtoLibraries(args)
+	empty := emptyRules(args, protoNames)
 	if len(protoNames) == 0 {
-		return language.GenerateResult{}
+		return language.GenerateResult{Empty: empty}
 	}
 
 	existingDart := collectExistingDartProtoLibraries(args)
@@ -36,7 +42,7 @@ func (pl *protoLang) GenerateRules(args language.GenerateArgs) language.Generate
 	sort.Strings(names)
 
 	if len(names) == 0 {
-		return language.GenerateResult{}
+		return language.GenerateResult{Empty: empty}
 	}
 
 	gen := make([]*rule.Rule, 0, len(names))
@@ -44,17 +50,44 @@ func (pl *protoLang) GenerateRules(args language.GenerateArgs) language.Generate
 	for _, name := range names {
 		dartName := name + "_dart"
 		r := rule.NewRule("dart_proto_library", dartName)
-		r.SetAttr("deps", []string{":" + name})
+		r.SetAttr("deps", []string{label.Label{Name: name, Relative: true}.String()})
 		gen = append(gen, r)
 		imports = append(imports, []resolve.ImportSpec{})
 	}
 
 	return language.GenerateResult{
 		Gen:     gen,
+		Empty:   empty,
 		Imports: imports,
 	}
 }
 
+// emptyRules returns empty rules for the dart_proto_library targets in the
+// BUILD file that wrap a proto_library no longer in protoNames, so Gazelle
+// deletes them along with their proto_library.
+func emptyRules(args language.GenerateArgs, protoNames map[string]bool) []*rule.Rule {
+	if args.File == nil {
+		return nil
+	}
+	var empty []*rule.Rule
+	for _, r := range args.File.Rules {
+		if r.Kind() != "dart_proto_library" {
+			continue
+		}
+		name := strings.TrimSuffix(r.Name(), "_dart")
+		if name == r.Name() || protoNames[name] {
+			continue
+		}
+		proto := label.Label{Name: name, Relative: true}.String()
+		if deps := r.AttrStrings("deps"); len(deps) != 1 || deps[0] != proto {
+			// Hand-written targets wrapping something else are left alone.
+			continue
+		}
+		empty = append(empty, rule.NewRule("dart_proto_library", r.Name()))
+	}
+	return empty
+}
+
 func collectProtoLibraries(args language.GenerateArgs) map[string]bool {
 	result := make(map[string]bool)
 
@@ -72,6 +105,13 @@ func collectProtoLibraries(args language.GenerateArgs) map[string]bool {
 		}
 	}
 
+	// proto_library targets other languages are about to delete don't count.
+	for _, r := range args.OtherEmpty {
+		if r.Kind() == "proto_library" {
+			delete(result, r.Name())
+		}
+	}
+
 	return result
 }
 
@@ -95,6 +135,16 @@ func collectExistingDartProtoLibraries(args language.GenerateArgs) map[string]bo
 	return result
 }
 
+// obsoleteAttrs lists the dart_proto_library attributes rules_flutter
+// removed, with what replaces them.
+var obsoleteAttrs = map[string]map[string]string{
+	"dart_proto_library": {
+		"grpc":    "gRPC stubs are generated for every proto that declares services",
+		"options": "it was ignored",
+	},
+}
+
+// Fix removes dart_proto_library attributes rules_flutter no longer accepts.
 func (pl *protoLang) Fix(c *config.Config, f *rule.File) {
-	// No automatic fixes required.
+	flutter.FixObsoleteAttrs(c, f, obsoleteAttrs)
 }
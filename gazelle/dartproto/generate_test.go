@@ -44,3 +44,106 @@ func TestGenerateRulesProducesProtoTargets(t *testing.T) {
 		t.Fatalf("dart_proto_library deps: want [:services_api_v1_proto], got %v", deps)
 	}
 }
+
+func TestFixRemovesObsoleteAttrs(t *testing.T) {
+	f, err := rule.LoadData("services/api/v1/BUILD.bazel", "services/api/v1", []byte(`
+dart_proto_library(
+    name = "api_proto_dart",
+    grpc = True,
+    options = {"mixins": "mixins.json"},
+    deps = [":api_proto"],
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pl := &protoLang{}
+	pl.Fix(&config.Config{}, f)
+	if r := f.Rules[0]; r.Attr("grpc") == nil || r.Attr("options") == nil {
+		t.Fatalf("obsolete attributes removed outside gazelle fix")
+	}
+
+	pl.Fix(&config.Config{ShouldFix: true}, f)
+	r := f.Rules[0]
+	if r.Attr("grpc") != nil || r.Attr("options") != nil {
+		t.Fatalf("obsolete attributes not removed: %s", f.Format())
+	}
+	if deps := r.AttrStrings("deps"); !reflect.DeepEqual(deps, []string{":api_proto"}) {
+		t.Fatalf("dart_proto_library deps: want [:api_proto], got %v", deps)
+	}
+}
+
+func TestGenerateRulesDeletesTargetsOfRemovedProtos(t *testing.T) {
+	f, err := rule.LoadData("services/api/v1/BUILD.bazel", "services/api/v1", []byte(`
+proto_library(
+    name = "api_proto",
+    srcs = ["api.proto"],
+)
+
+proto_library(
+    name = "old_proto",
+    srcs = ["old.proto"],
+)
+
+dart_proto_library(
+    name = "api_proto_dart",
+    deps = [":api_proto"],
+)
+
+dart_proto_library(
+    name = "old_proto_dart",
+    deps = [":old_proto"],
+)
+
+dart_proto_library(
+    name = "gone_proto_dart",
+    deps = [":gone_proto"],
+)
+
+dart_proto_library(
+    name = "bundle_dart",
+    deps = ["//protos:bundle_proto"],
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pl := &protoLang{}
+	cfg := &config.Config{Exts: map[string]interface{}{}}
+	cfg.Exts["flutter"] = &flutter.FlutterConfig{LibraryName: "lib", Generate: true}
+	result := pl.GenerateRules(language.GenerateArgs{
+		Config:     cfg,
+		Rel:        "services/api/v1",
+		File:       f,
+		OtherEmpty: []*rule.Rule{rule.NewRule("proto_library", "old_proto")},
+	})
+
+	var empty []string
+	for _, r := range result.Empty {
+		empty = append(empty, r.Name())
+	}
+	if want := []string{"old_proto_dart", "gone_proto_dart"}; !reflect.DeepEqual(empty, want) {
+		t.Fatalf("empty rules: want %v, got %v", want, empty)
+	}
+}
+
+func TestGenerateRulesDeletesTargetsWhenGenerationIsOff(t *testing.T) {
+	f, err := rule.LoadData("api/BUILD.bazel", "api", []byte(`
+dart_proto_library(
+    name = "old_proto_dart",
+    deps = [":old_proto"],
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{Exts: map[string]interface{}{}}
+	cfg.Exts["flutter"] = &flutter.FlutterConfig{LibraryName: "lib", Generate: false}
+	result := (&protoLang{}).GenerateRules(language.GenerateArgs{Config: cfg, Rel: "api", File: f})
+	if len(result.Gen) != 0 || len(result.Empty) != 1 || result.Empty[0].Name() != "old_proto_dart" {
+		t.Fatalf("expected only old_proto_dart to be deleted, got %v and %v", result.Gen, result.Empty)
+	}
+}
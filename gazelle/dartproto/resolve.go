@@ -6,6 +6,7 @@ import (
 	"github.com/bazelbuild/bazel-gazelle/repo"
 	"github.com/bazelbuild/bazel-gazelle/resolve"
 	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/spencerconnaughton/rules_flutter/gazelle/flutter"
 )
 
 func (pl *protoLang) Kinds() map[string]rule.KindInfo {
@@ -35,7 +36,11 @@ func (pl *protoLang) Loads() []rule.LoadInfo {
 }
 
 func (pl *protoLang) ApparentLoads(moduleToApparentName func(string) string) []rule.LoadInfo {
-	return pl.Loads()
+	loads := pl.Loads()
+	for i := range loads {
+		loads[i].Name = flutter.ApparentDefsBzl(moduleToApparentName)
+	}
+	return loads
 }
 
 func (pl *protoLang) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.ImportSpec {
@@ -0,0 +1,130 @@
+package flutter
+
+import (
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"gopkg.in/yaml.v3"
+)
+
+// analysisOptionsFile is the analyzer configuration flutter analyze reads
+// from the package root.
+const analysisOptionsFile = "analysis_options.yaml"
+
+// AnalysisOptions holds the analysis_options.yaml settings Gazelle reads.
+type AnalysisOptions struct {
+	// Include names another options file, often from a lints package, e.g.
+	// "package:flutter_lints/flutter.yaml"
+	Include string `yaml:"include"`
+
+	Analyzer struct {
+		// Exclude lists globs, relative to the options file, of files the
+		// analyzer skips
+		Exclude []string `yaml:"exclude"`
+	} `yaml:"analyzer"`
+}
+
+// ParseAnalysisOptions parses an analysis_options.yaml file.
+func ParseAnalysisOptions(path string) (*AnalysisOptions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var options AnalysisOptions
+	if err := yaml.Unmarshal(data, &options); err != nil {
+		return nil, err
+	}
+	return &options, nil
+}
+
+// IncludedPackage returns the package the options include from, or "".
+func (o *AnalysisOptions) IncludedPackage() string {
+	rest, ok := strings.CutPrefix(o.Include, "package:")
+	if !ok {
+		return ""
+	}
+	pkg, _, _ := strings.Cut(rest, "/")
+	return pkg
+}
+
+// excludes reports whether the analyzer skips the package-relative file p.
+func (o *AnalysisOptions) excludes(p string) bool {
+	for _, pattern := range o.Analyzer.Exclude {
+		pattern = strings.TrimPrefix(pattern, "./")
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+		for _, expanded := range expandBraces(pattern) {
+			if matchGlob(expanded, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expandBraces expands the "{a,b}" alternatives of an analyzer glob into
+// plain globs. Nested braces are not supported and are returned as written.
+func expandBraces(pattern string) []string {
+	open := strings.Index(pattern, "{")
+	if open < 0 {
+		return []string{pattern}
+	}
+	end := strings.Index(pattern[open:], "}")
+	if end < 0 || strings.Contains(pattern[open+1:open+end], "{") {
+		return []string{pattern}
+	}
+	var expanded []string
+	for _, alt := range strings.Split(pattern[open+1:open+end], ",") {
+		expanded = append(expanded, expandBraces(pattern[:open]+alt+pattern[open+end+1:])...)
+	}
+	return expanded
+}
+
+// generateAnalyzeRule returns a flutter_analyze_test for packages with an
+// analysis_options.yaml, or nil. Its srcs overlay the options file and the
+// test sources the analyzer doesn't exclude onto the library workspace; the
+// caller sets embed. The options are returned for their include.
+func generateAnalyzeRule(args language.GenerateArgs, fc *FlutterConfig, test *rule.Rule) (*rule.Rule, *AnalysisOptions) {
+	if fc.Analyze == AnalyzeOff || !containsString(args.RegularFiles, analysisOptionsFile) ||
+		fc.IsExcluded(path.Join(args.Rel, analysisOptionsFile)) {
+		return nil, nil
+	}
+	options, err := ParseAnalysisOptions(filepath.Join(args.Dir, analysisOptionsFile))
+	if err != nil {
+		log.Printf("//%s: %s: %v", args.Rel, analysisOptionsFile, err)
+		options = &AnalysisOptions{}
+	}
+
+	srcs := []string{analysisOptionsFile}
+	if test != nil {
+		for _, src := range test.AttrStrings("srcs") {
+			if !options.excludes(filepath.ToSlash(src)) {
+				srcs = append(srcs, src)
+			}
+		}
+	}
+
+	sort.Strings(srcs)
+
+	r := rule.NewRule("flutter_analyze_test", analyzeRuleName(fc))
+	r.SetAttr("srcs", srcs)
+	switch fc.Analyze {
+	case AnalyzeInfos:
+		r.SetAttr("fatal_infos", true)
+	case AnalyzeErrors:
+		r.SetAttr("fatal_warnings", false)
+	}
+	return r, options
+}
+
+// analyzeRuleName returns the name of the generated flutter_analyze_test.
+func analyzeRuleName(fc *FlutterConfig) string {
+	return fc.LibraryName + "_analyze"
+}
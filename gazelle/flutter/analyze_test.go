@@ -0,0 +1,162 @@
+package flutter
+
+import (
+	"reflect"
+	"testing"
+
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+func TestAnalysisOptionsExcludes(t *testing.T) {
+	options := &AnalysisOptions{}
+	options.Analyzer.Exclude = []string{"**/*.g.dart", "test/fixtures/", "./lib/{generated,l10n}/**"}
+
+	for p, want := range map[string]bool{
+		"lib/model.g.dart":           true,
+		"test/fixtures/broken.dart":  true,
+		"lib/generated/api.dart":     true,
+		"lib/l10n/messages.dart":     true,
+		"lib/main.dart":              false,
+		"test/widget_test.dart":      false,
+		"test/fixtures_test.dart":    false,
+		"lib/generated_widgets.dart": false,
+	} {
+		if got := options.excludes(p); got != want {
+			t.Errorf("excludes(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestExpandBraces(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		want    []string
+	}{
+		{"lib/**", []string{"lib/**"}},
+		{"{a,b}/*.{g,freezed}.dart", []string{"a/*.g.dart", "a/*.freezed.dart", "b/*.g.dart", "b/*.freezed.dart"}},
+		{"lib/{a", []string{"lib/{a"}},
+	} {
+		if got := expandBraces(tc.pattern); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("expandBraces(%q) = %q, want %q", tc.pattern, got, tc.want)
+		}
+	}
+}
+
+const analyzePubspec = `name: example
+environment:
+  flutter: ">=3.0.0"
+dependencies:
+  flutter:
+    sdk: flutter
+dev_dependencies:
+  flutter_lints: ^4.0.0
+`
+
+func TestGenerateRulesAddsAnalyzeTest(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":              analyzePubspec,
+		"analysis_options.yaml":     "include: package:flutter_lints/flutter.yaml\nanalyzer:\n  exclude:\n    - test/fixtures/**\n",
+		"lib/main.dart":             "void main() {}\n",
+		"test/main_test.dart":       "void main() {}\n",
+		"test/fixtures/broken.dart": "not dart\n",
+	})
+
+	for _, tc := range []struct {
+		analyze string
+		attrs   map[string]string
+	}{
+		{analyze: ""},
+		{analyze: AnalyzeInfos, attrs: map[string]string{"fatal_infos": "True"}},
+		{analyze: AnalyzeErrors, attrs: map[string]string{"fatal_warnings": "False"}},
+	} {
+		args := generateArgs(t, dir, "example")
+		GetFlutterConfig(args.Config).Analyze = tc.analyze
+		result := (&flutterLang{}).GenerateRules(args)
+
+		r := findRule(result.Gen, "flutter_analyze_test", "lib_analyze")
+		if r == nil {
+			t.Fatalf("%q: no flutter_analyze_test generated", tc.analyze)
+		}
+		if got, want := r.AttrStrings("srcs"), []string{"analysis_options.yaml", "test/main_test.dart"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: srcs: want %v, got %v", tc.analyze, want, got)
+		}
+		// flutter_lints is a dev dependency, so the analysis needs lib_dev.
+		if got, want := r.AttrStrings("embed"), []string{":lib_dev"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: embed: want %v, got %v", tc.analyze, want, got)
+		}
+		for _, attr := range []string{"fatal_infos", "fatal_warnings"} {
+			var got string
+			if value := r.Attr(attr); value != nil {
+				got = bzl.FormatString(value)
+			}
+			if want := tc.attrs[attr]; got != want {
+				t.Errorf("%q: %s = %q, want %q", tc.analyze, attr, got, want)
+			}
+		}
+	}
+}
+
+func TestGenerateRulesAnalyzesPackagesWithoutTests(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":          "name: example\nenvironment:\n  sdk: \">=3.0.0 <4.0.0\"\n",
+		"analysis_options.yaml": "",
+		"lib/example.dart":      "",
+	})
+
+	result := (&flutterLang{}).GenerateRules(generateArgs(t, dir, "example"))
+	r := findRule(result.Gen, "flutter_analyze_test", "lib_analyze")
+	if r == nil {
+		t.Fatal("no flutter_analyze_test generated")
+	}
+	if got, want := r.AttrStrings("embed"), []string{":lib"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("embed: want %v, got %v", want, got)
+	}
+	if len(result.Imports) != len(result.Gen) {
+		t.Errorf("%d imports for %d rules", len(result.Imports), len(result.Gen))
+	}
+}
+
+func TestGenerateRulesDeletesAnalyzeTestOnlyWithItsLibrary(t *testing.T) {
+	const buildFile = `
+flutter_library(
+    name = "lib",
+    srcs = ["lib/main.dart"],
+    pubspec = "pubspec.yaml",
+)
+
+flutter_analyze_test(
+    name = "lib_analyze",
+    srcs = glob(["test/**"]),
+    embed = [":lib"],
+)
+`
+	for _, tc := range []struct {
+		name    string
+		files   map[string]string
+		analyze string
+		want    []string
+	}{{
+		name:  "no analysis_options.yaml",
+		files: map[string]string{"pubspec.yaml": analyzePubspec, "lib/main.dart": "void main() {}\n"},
+		want:  []string{"flutter_analyze_test lib_analyze", "flutter_library lib"},
+	}, {
+		name:    "flutter_analyze off",
+		files:   map[string]string{"pubspec.yaml": analyzePubspec, "analysis_options.yaml": "", "lib/main.dart": "void main() {}\n"},
+		analyze: AnalyzeOff,
+		want:    []string{"flutter_analyze_test lib_analyze", "flutter_library lib"},
+	}, {
+		name:  "pubspec.yaml removed",
+		files: map[string]string{"analysis_options.yaml": "", "lib/main.dart": "void main() {}\n"},
+		want:  nil,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			args := generateArgs(t, writePackage(t, tc.files), "app")
+			if tc.analyze != "" {
+				GetFlutterConfig(args.Config).Analyze = tc.analyze
+			}
+			if got := mergeGenerated(t, args, buildFile); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
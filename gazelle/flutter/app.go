@@ -0,0 +1,172 @@
+package flutter
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// appRuleName is the name of the generated flutter_app target.
+const appRuleName = "app"
+
+// appPlatform maps a Flutter platform directory to the flutter_app macro
+// attribute that receives its overlay files.
+type appPlatform struct {
+	Dir  string
+	Attr string
+}
+
+// appPlatforms lists the platform directories flutter create scaffolds, in
+// the order flutter_app emits their targets.
+var appPlatforms = []appPlatform{
+	{Dir: "web", Attr: "web"},
+	{Dir: "android", Attr: "apk"},
+	{Dir: "ios", Attr: "ios"},
+	{Dir: "macos", Attr: "macos"},
+	{Dir: "linux", Attr: "linux"},
+	{Dir: "windows", Attr: "windows"},
+}
+
+// platformArtifactDirs are directory names produced by platform tooling
+// (Gradle, CocoaPods, flutter's ephemeral configs), and the Xcode test
+// target's sources, that never belong in an overlay.
+var platformArtifactDirs = map[string]bool{
+	".gradle":     true,
+	".symlinks":   true,
+	"Pods":        true,
+	"RunnerTests": true,
+	"build":       true,
+	"ephemeral":   true,
+}
+
+// platformArtifactFiles are machine-local files written by flutter and the
+// platform toolchains.
+var platformArtifactFiles = map[string]bool{
+	"Generated.xcconfig":              true,
+	"flutter_export_environment.sh":   true,
+	"local.properties":                true,
+	"GeneratedPluginRegistrant.java":  true,
+	"generated_plugin_registrant.cc":  true,
+	"generated_plugin_registrant.h":   true,
+	"generated_plugins.cmake":         true,
+	"GeneratedPluginRegistrant.swift": true,
+}
+
+// generateAppRule returns a flutter_app embedding the package library with
+// one platform attribute per platform directory present, or nil when the
+// package has none. An existing app keeps the platforms it builds: only the
+// attributes it already sets are updated.
+func generateAppRule(args language.GenerateArgs, fc *FlutterConfig) *rule.Rule {
+	subdirs := make(map[string]bool, len(args.Subdirs))
+	for _, d := range args.Subdirs {
+		subdirs[d] = true
+	}
+
+	existing := existingRule(args.File, "flutter_app", appRuleName)
+	if existing == nil && hasRuleOfKind(args.File, "flutter_app") {
+		// A hand-written app under another name owns this package.
+		return nil
+	}
+
+	r := rule.NewRule("flutter_app", appRuleName)
+	hasPlatform := false
+	for _, p := range appPlatforms {
+		if !subdirs[p.Dir] || fc.IsExcluded(path.Join(args.Rel, p.Dir)) {
+			continue
+		}
+		if existing != nil && existing.Attr(p.Attr) == nil {
+			continue
+		}
+		// Dict specs and other hand-written expressions are carried through
+		// the merge unchanged.
+		if existing != nil && existing.Attr(p.Attr) != nil && existing.AttrStrings(p.Attr) == nil {
+			r.SetAttr(p.Attr, keptExpr{existing.Attr(p.Attr)})
+			hasPlatform = true
+			continue
+		}
+		files := platformOverlayFiles(args.Dir, p.Dir, args.Config.ValidBuildFileNames, fc, args.Rel)
+		if len(files) == 0 {
+			continue
+		}
+		r.SetAttr(p.Attr, files)
+		hasPlatform = true
+	}
+	if !hasPlatform {
+		return nil
+	}
+
+	r.SetAttr("embed", []string{localLabel(fc.LibraryName)})
+	return r
+}
+
+// keptExpr is an attribute value that merges into an existing rule without
+// changing it, for hand-written expressions Gazelle can't merge.
+type keptExpr struct {
+	expr bzl.Expr
+}
+
+// BzlExpr returns the hand-written expression.
+func (v keptExpr) BzlExpr() bzl.Expr {
+	return v.expr
+}
+
+// Merge returns other unchanged.
+func (v keptExpr) Merge(other bzl.Expr) bzl.Expr {
+	if other == nil {
+		return v.expr
+	}
+	return other
+}
+
+// platformOverlayFiles lists the files under a platform directory, skipping
+// build outputs, machine-local configuration, flutter_exclude matches and
+// subpackages.
+func platformOverlayFiles(baseDir, platformDir string, buildFileNames []string, fc *FlutterConfig, rel string) []string {
+	dir := filepath.Join(baseDir, platformDir)
+	if isSubpackage(dir, buildFileNames) {
+		return nil
+	}
+	skip := packageFilter(baseDir, buildFileNames, fc, rel)
+	files := walkDirFiltered(dir, baseDir, func(relPath string, info os.FileInfo) bool {
+		if skip(relPath, info) {
+			return true
+		}
+		if info.IsDir() {
+			return platformArtifactDirs[info.Name()]
+		}
+		return platformArtifactFiles[info.Name()]
+	})
+	sort.Strings(files)
+	return files
+}
+
+// existingRule returns the rule of the given kind and name in f, if any.
+func existingRule(f *rule.File, kind, name string) *rule.Rule {
+	if f == nil {
+		return nil
+	}
+	for _, r := range f.Rules {
+		if r.Kind() == kind && r.Name() == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// hasRuleOfKind reports whether f declares any rule of the given kind.
+func hasRuleOfKind(f *rule.File, kind string) bool {
+	if f == nil {
+		return false
+	}
+	for _, r := range f.Rules {
+		if r.Kind() == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package flutter
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/merger"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+func TestGenerateRulesEmitsFlutterApp(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":                           "name: example\nenvironment:\n  flutter: '>=3.24.0'\n",
+		"lib/main.dart":                          "void main() {}\n",
+		"web/index.html":                         "<html></html>\n",
+		"android/app/build.gradle":               "",
+		"android/local.properties":               "sdk.dir=/tmp\n",
+		"android/.gradle/8.0/checksums.lock":     "",
+		"android/app/build/outputs/app.apk":      "",
+		"ios/Runner/AppDelegate.swift":           "",
+		"ios/RunnerTests/RunnerTests.swift":      "",
+		"ios/Flutter/Generated.xcconfig":         "",
+		"ios/Pods/Manifest.lock":                 "",
+		"ios/Flutter/ephemeral/flutter_lldbinit": "",
+	})
+
+	result := (&flutterLang{}).GenerateRules(generateArgs(t, dir, "example"))
+	app := findRule(result.Gen, "flutter_app", "app")
+	if app == nil {
+		t.Fatalf("expected a flutter_app rule, got %v", result.Gen)
+	}
+
+	want := map[string][]string{
+		"embed": {":lib"},
+		"web":   {"web/index.html"},
+		"apk":   {"android/app/build.gradle"},
+		"ios":   {"ios/Runner/AppDelegate.swift"},
+		"macos": nil,
+	}
+	for attr, files := range want {
+		if got := app.AttrStrings(attr); !reflect.DeepEqual(got, files) {
+			t.Errorf("flutter_app %s: want %v got %v", attr, files, got)
+		}
+	}
+}
+
+func TestGenerateRulesSkipsAppForDartPackages(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":   "name: example\nenvironment:\n  sdk: '>=3.0.0 <4.0.0'\n",
+		"lib/util.dart":  "",
+		"web/index.html": "",
+	})
+
+	result := (&flutterLang{}).GenerateRules(generateArgs(t, dir, "example"))
+	if app := findRule(result.Gen, "flutter_app", "app"); app != nil {
+		t.Fatalf("did not expect a flutter_app for a Dart package")
+	}
+}
+
+func TestGenerateAppRuleLeavesExistingPlatformsAlone(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":   "name: example\n",
+		"web/index.html": "",
+		"linux/main.cc":  "",
+	})
+
+	args := generateArgs(t, dir, "example")
+	f, err := rule.LoadData("BUILD.bazel", "example", []byte(`
+flutter_app(
+    name = "app",
+    embed = [":lib"],
+    web = {"srcs": [":web_files"]},
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args.File = f
+
+	app := generateAppRule(args, GetFlutterConfig(args.Config))
+	if app == nil {
+		t.Fatalf("expected a flutter_app rule")
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	rule.MergeRules(app, f.Rules[0], (&flutterLang{}).Kinds()["flutter_app"].MergeableAttrs, f.Path)
+
+	if strings.Contains(logs.String(), "could not merge") {
+		t.Errorf("merging the app logged an error:\n%s", logs.String())
+	}
+	if got, want := bzl.FormatString(f.Rules[0].Attr("web")), `{"srcs": [":web_files"]}`; got != want {
+		t.Errorf("flutter_app web: want %s got %s", want, got)
+	}
+	if got := f.Rules[0].Attr("linux"); got != nil {
+		t.Errorf("flutter_app linux: an existing app gained a platform: %s", bzl.FormatString(got))
+	}
+}
+
+func TestGenerateRulesKeepsHandWrittenAppSrcs(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":   "name: example\n",
+		"lib/main.dart":  "void main() {}\n",
+		"web/index.html": "",
+	})
+	args := generateArgs(t, dir, "example")
+	f, err := rule.LoadData("BUILD.bazel", "example", []byte(`
+flutter_app(
+    name = "app",
+    srcs = ["main_dev.dart"],
+    embed = [":lib"],
+    web = ["web/old.html"],
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args.File = f
+	fl := &flutterLang{}
+	res := fl.GenerateRules(args)
+	merger.MergeFile(f, res.Empty, res.Gen, merger.PreResolve, fl.Kinds())
+
+	app := existingRule(f, "flutter_app", "app")
+	if got := app.AttrStrings("srcs"); !reflect.DeepEqual(got, []string{"main_dev.dart"}) {
+		t.Errorf("flutter_app srcs: want [main_dev.dart] got %v", got)
+	}
+	if got := app.AttrStrings("web"); !reflect.DeepEqual(got, []string{"web/index.html"}) {
+		t.Errorf("flutter_app web: want [web/index.html] got %v", got)
+	}
+}
+
+func TestGenerateRulesDeletesStaleApp(t *testing.T) {
+	const buildFile = `
+flutter_library(
+    name = "lib",
+    srcs = ["lib/main.dart"],
+    pubspec = "pubspec.yaml",
+)
+
+flutter_app(
+    name = "app",
+    embed = [":lib"],
+    web = ["web/index.html"],
+)
+
+flutter_app(
+    name = "demo",
+    embed = ["//demo:lib"],
+)
+`
+	for name, files := range map[string]map[string]string{
+		"pubspec removed": {
+			"lib/main.dart":  "void main() {}\n",
+			"web/index.html": "",
+		},
+		"platforms removed": {
+			"pubspec.yaml":  "name: example\n",
+			"lib/main.dart": "void main() {}\n",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got := mergeGenerated(t, generateArgs(t, writePackage(t, files), "example"), buildFile)
+			if containsString(got, "flutter_app app") {
+				t.Fatalf("expected the stale app to be deleted, got %v", got)
+			}
+			if !containsString(got, "flutter_app demo") {
+				t.Fatalf("expected the hand-written app to stay, got %v", got)
+			}
+		})
+	}
+}
+
+// findRule returns the generated rule with the given kind and name.
+func findRule(rules []*rule.Rule, kind, name string) *rule.Rule {
+	for _, r := range rules {
+		if r.Kind() == kind && r.Name() == name {
+			return r
+		}
+	}
+	return nil
+}
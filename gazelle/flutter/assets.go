@@ -0,0 +1,384 @@
+package flutter
+
+import (
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+	"gopkg.in/yaml.v3"
+)
+
+// PubspecFlutter is the flutter: section of a pubspec.yaml.
+type PubspecFlutter struct {
+	// Assets lists the declared asset paths. Paths ending in "/" name
+	// directories whose files are all assets.
+	Assets []string
+
+	// Fonts lists the font files of every declared font family
+	Fonts []string
+
+	// Shaders lists the declared fragment shader sources
+	Shaders []string
+
+	// Generate is set by "generate: true", which runs flutter gen-l10n
+	Generate bool
+}
+
+// UnmarshalYAML decodes the flutter: section. Asset entries may be plain
+// paths or maps with a "path" key (used for flavors and transformers).
+// Malformed entries are left out rather than failing the whole pubspec, since
+// the flutter tool reports them.
+func (f *PubspecFlutter) UnmarshalYAML(node *yaml.Node) error {
+	var raw struct {
+		Assets []yaml.Node `yaml:"assets"`
+		Fonts  []struct {
+			Fonts []struct {
+				Asset string `yaml:"asset"`
+			} `yaml:"fonts"`
+		} `yaml:"fonts"`
+		Shaders  []string `yaml:"shaders"`
+		Generate bool     `yaml:"generate"`
+	}
+	_ = node.Decode(&raw)
+
+	for _, asset := range raw.Assets {
+		var entry struct {
+			Path string `yaml:"path"`
+		}
+		if asset.Kind == yaml.ScalarNode {
+			entry.Path = asset.Value
+		} else if err := asset.Decode(&entry); err != nil {
+			continue
+		}
+		if entry.Path != "" {
+			f.Assets = append(f.Assets, entry.Path)
+		}
+	}
+	for _, family := range raw.Fonts {
+		for _, font := range family.Fonts {
+			if font.Asset != "" {
+				f.Fonts = append(f.Fonts, font.Asset)
+			}
+		}
+	}
+	for _, shader := range raw.Shaders {
+		if shader != "" {
+			f.Shaders = append(f.Shaders, shader)
+		}
+	}
+	f.Generate = raw.Generate
+	return nil
+}
+
+// assetVariantDir matches the resolution-aware variant directories Flutter
+// looks for next to an asset, such as "2.0x" and "3x".
+var assetVariantDir = regexp.MustCompile(`^\d+(\.\d*)?x$`)
+
+// pubspecDataFiles returns the files the flutter: section of pubspec declares
+// as assets, fonts and shaders, relative to the package in dir, sorted.
+// Like flutter, it takes the files directly inside a declared directory and
+// the resolution variants ("2.0x/logo.png") of every asset. Declared paths
+// that don't exist are reported. rel is the repository-relative path of dir.
+func pubspecDataFiles(dir string, pubspec *PubspecYaml, fc *FlutterConfig, rel string) []string {
+	if pubspec == nil || pubspec.Flutter == nil {
+		return nil
+	}
+	c := &dataCollector{
+		dir:  dir,
+		rel:  rel,
+		skip: fc.excludeFilter(rel),
+		seen: make(map[string]bool),
+	}
+	for _, asset := range pubspec.Flutter.Assets {
+		if strings.HasSuffix(asset, "/") {
+			c.addAssetDir(asset)
+		} else {
+			c.addAsset(asset)
+		}
+	}
+	for _, font := range pubspec.Flutter.Fonts {
+		c.addFile("font", font)
+	}
+	for _, shader := range pubspec.Flutter.Shaders {
+		c.addFile("shader", shader)
+	}
+	sort.Strings(c.files)
+	return c.files
+}
+
+// dataCollector accumulates the files of a pubspecDataFiles call.
+type dataCollector struct {
+	dir   string
+	rel   string
+	skip  func(relPath string, info os.FileInfo) bool
+	seen  map[string]bool
+	files []string
+}
+
+// clean returns the package-relative form of the declared path p, or false
+// after reporting paths Bazel can't reference from this package. Assets of
+// other packages ("packages/<name>/...") come with their deps and are
+// skipped quietly.
+func (c *dataCollector) clean(kind, p string) (string, bool) {
+	if strings.HasPrefix(p, "packages/") {
+		return "", false
+	}
+	cleaned := path.Clean(p)
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		log.Printf("//%s: pubspec.yaml declares %s %q outside the package; add it to data by hand", c.rel, kind, p)
+		return "", false
+	}
+	return cleaned, true
+}
+
+// add records the package-relative file p unless it's hidden, excluded or
+// already recorded.
+func (c *dataCollector) add(p string, info os.FileInfo) {
+	if c.seen[p] || isIgnoredFileName(info.Name()) {
+		return
+	}
+	if c.skip != nil && c.skip(filepath.FromSlash(p), info) {
+		return
+	}
+	c.seen[p] = true
+	c.files = append(c.files, p)
+}
+
+// addFile records a declared font or shader.
+func (c *dataCollector) addFile(kind, p string) {
+	p, ok := c.clean(kind, p)
+	if !ok {
+		return
+	}
+	info, err := os.Stat(filepath.Join(c.dir, filepath.FromSlash(p)))
+	if err != nil || !info.Mode().IsRegular() {
+		log.Printf("//%s: pubspec.yaml declares %s %q, which doesn't exist", c.rel, kind, p)
+		return
+	}
+	c.add(p, info)
+}
+
+// addAsset records a declared asset file and its resolution variants.
+func (c *dataCollector) addAsset(p string) {
+	p, ok := c.clean("asset", p)
+	if !ok {
+		return
+	}
+	info, err := os.Stat(filepath.Join(c.dir, filepath.FromSlash(p)))
+	if err != nil || info.IsDir() {
+		log.Printf("//%s: pubspec.yaml declares asset %q, which doesn't exist", c.rel, p)
+		return
+	}
+	c.add(p, info)
+	c.addVariants(path.Dir(p), []string{path.Base(p)})
+}
+
+// addAssetDir records the files directly inside a declared asset directory
+// and their resolution variants.
+func (c *dataCollector) addAssetDir(p string) {
+	p, ok := c.clean("asset", p)
+	if !ok {
+		return
+	}
+	entries, err := os.ReadDir(filepath.Join(c.dir, filepath.FromSlash(p)))
+	if os.IsNotExist(err) {
+		log.Printf("//%s: pubspec.yaml declares asset directory %q, which doesn't exist", c.rel, p+"/")
+		return
+	} else if err != nil {
+		log.Printf("//%s: asset directory %q: %v", c.rel, p+"/", err)
+		return
+	}
+	var names []string
+	for _, entry := range entries {
+		info, err := os.Stat(filepath.Join(c.dir, filepath.FromSlash(p), entry.Name()))
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		c.add(path.Join(p, entry.Name()), info)
+		names = append(names, entry.Name())
+	}
+	c.addVariants(p, names)
+}
+
+// addVariants records the variants of the assets named names in the
+// package-relative directory dir, e.g. "dir/2.0x/<name>".
+func (c *dataCollector) addVariants(dir string, names []string) {
+	entries, err := os.ReadDir(filepath.Join(c.dir, filepath.FromSlash(dir)))
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !assetVariantDir.MatchString(entry.Name()) {
+			continue
+		}
+		for _, name := range names {
+			variant := path.Join(dir, entry.Name(), name)
+			if info, err := os.Stat(filepath.Join(c.dir, filepath.FromSlash(variant))); err == nil && info.Mode().IsRegular() {
+				c.add(variant, info)
+			}
+		}
+	}
+}
+
+// dataValue is the generated data of a library: the files pubspec declares
+// and the gen-l10n inputs. Merged into an existing rule, it adds and removes
+// only the entries it owns and keeps everything else, so hand-written data
+// survives.
+type dataValue struct {
+	// files are the generated data files, relative to the package
+	files []string
+
+	// owned reports whether a data entry is one Gazelle manages
+	owned func(entry string) bool
+}
+
+// BzlExpr renders the files as a sorted list.
+func (v dataValue) BzlExpr() bzl.Expr {
+	return rule.SortedStrings(v.files).BzlExpr()
+}
+
+// Merge updates the owned entries of a list in other, keeping the rest.
+// Expressions other than plain lists are hand-written and kept as they are.
+func (v dataValue) Merge(other bzl.Expr) bzl.Expr {
+	if other == nil {
+		if len(v.files) == 0 {
+			return nil
+		}
+		return v.BzlExpr()
+	}
+	list, ok := other.(*bzl.ListExpr)
+	if !ok {
+		return other
+	}
+
+	generated := make(map[string]bool, len(v.files))
+	for _, f := range v.files {
+		generated[f] = true
+	}
+	present := make(map[string]bool)
+	var merged []bzl.Expr
+	for _, x := range list.List {
+		if s, ok := x.(*bzl.StringExpr); ok {
+			if !generated[s.Value] && v.owned != nil && v.owned(s.Value) && !rule.ShouldKeep(s) {
+				continue
+			}
+			present[s.Value] = true
+		}
+		merged = append(merged, x)
+	}
+	for _, f := range v.files {
+		if !present[f] {
+			merged = append(merged, &bzl.StringExpr{Value: f})
+		}
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		a, aok := merged[i].(*bzl.StringExpr)
+		b, bok := merged[j].(*bzl.StringExpr)
+		return aok && bok && a.Value < b.Value
+	})
+	return &bzl.ListExpr{List: merged, ForceMultiLine: list.ForceMultiLine || len(merged) > 1}
+}
+
+// setOwnedAttr sets key to value on r, a generated rule, when generated is
+// set or when the rule it merges into in f already has the attribute. The
+// merge then updates that attribute through value rather than dropping it.
+func setOwnedAttr(r *rule.Rule, key string, value interface{}, generated bool, f *rule.File) {
+	existing := existingRule(f, r.Kind(), r.Name())
+	if generated || existing != nil && existing.Attr(key) != nil {
+		r.SetAttr(key, value)
+	}
+}
+
+// pubspecDataOwner returns a predicate matching the data entries Gazelle
+// manages for pubspec, the package in pkgDir: files an asset, font or shader
+// declaration of the flutter: section covers, gen-l10n inputs (l10n.yaml and
+// ARB files), and files that no longer exist. The last catches entries whose
+// declaration was removed along with the file; paths a target in f, the
+// existing BUILD file, provides are not files and stay.
+func pubspecDataOwner(pkgDir string, pubspec *PubspecYaml, f *rule.File) func(entry string) bool {
+	var dirs, files []string
+	if pubspec != nil && pubspec.Flutter != nil {
+		for _, asset := range pubspec.Flutter.Assets {
+			if p, ok := ownedDataPath(asset); ok && strings.HasSuffix(asset, "/") {
+				dirs = append(dirs, p)
+			} else if ok {
+				files = append(files, p)
+			}
+		}
+		for _, declared := range [][]string{pubspec.Flutter.Fonts, pubspec.Flutter.Shaders} {
+			for _, f := range declared {
+				if p, ok := ownedDataPath(f); ok {
+					files = append(files, p)
+				}
+			}
+		}
+	}
+
+	return func(entry string) bool {
+		if entry == "l10n.yaml" || strings.HasSuffix(entry, ".arb") {
+			return true
+		}
+		dir, base := path.Dir(entry), path.Base(entry)
+		// Resolution variants live in a "2.0x"-style directory next to
+		// the asset.
+		variantOf := ""
+		if assetVariantDir.MatchString(path.Base(dir)) {
+			variantOf = path.Join(path.Dir(dir), base)
+		}
+		for _, d := range dirs {
+			if dir == d || variantOf != "" && path.Dir(variantOf) == d {
+				return true
+			}
+		}
+		for _, f := range files {
+			if entry == f || variantOf == f {
+				return true
+			}
+		}
+		return isMissingFile(pkgDir, entry, f)
+	}
+}
+
+// isMissingFile reports whether entry, a data entry of a rule in f, names a
+// file of the package in dir that doesn't exist. Labels and the names and
+// outputs of targets declared in f are not files.
+func isMissingFile(dir, entry string, f *rule.File) bool {
+	if strings.ContainsAny(entry, ":@") || strings.HasPrefix(entry, "//") {
+		return false
+	}
+	p, ok := ownedDataPath(entry)
+	if !ok {
+		return false
+	}
+	if f != nil {
+		for _, r := range f.Rules {
+			if r.Name() == p || r.AttrString("out") == p || containsString(r.AttrStrings("outs"), p) {
+				return false
+			}
+		}
+	}
+	_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(p)))
+	return os.IsNotExist(err)
+}
+
+// ownedDataPath returns the package-relative form of a declared path, or
+// false for paths outside the package.
+func ownedDataPath(p string) (string, bool) {
+	if strings.HasPrefix(p, "packages/") {
+		return "", false
+	}
+	cleaned := path.Clean(p)
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", false
+	}
+	return cleaned, true
+}
@@ -0,0 +1,212 @@
+package flutter
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/merger"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestParsePubspecFlutterSection(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml": `name: example
+flutter:
+  uses-material-design: true
+  generate: true
+  assets:
+    - assets/
+    - images/logo.png
+    - path: assets/flavored/
+      flavors: [staging]
+    - {}
+    - [nested]
+  fonts:
+    - family: Inter
+      fonts:
+        - asset: fonts/Inter-Regular.ttf
+        - asset: fonts/Inter-Bold.ttf
+          weight: 700
+  shaders:
+    - shaders/blur.frag
+`,
+	})
+
+	pubspec, err := ParsePubspecYaml(filepath.Join(dir, "pubspec.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &PubspecFlutter{
+		Assets:   []string{"assets/", "images/logo.png", "assets/flavored/"},
+		Fonts:    []string{"fonts/Inter-Regular.ttf", "fonts/Inter-Bold.ttf"},
+		Shaders:  []string{"shaders/blur.frag"},
+		Generate: true,
+	}
+	if !reflect.DeepEqual(pubspec.Flutter, want) {
+		t.Fatalf("want %+v, got %+v", want, pubspec.Flutter)
+	}
+}
+
+func TestParsePubspecToleratesMalformedFlutterSection(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml": "name: example\nflutter:\n  assets: assets/\n  fonts: 3\n",
+	})
+
+	pubspec, err := ParsePubspecYaml(filepath.Join(dir, "pubspec.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pubspec.Name != "example" || len(pubspec.Flutter.Assets) != 0 {
+		t.Fatalf("got %+v", pubspec)
+	}
+}
+
+func TestPubspecDataFiles(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml": `name: example
+flutter:
+  assets:
+    - assets/
+    - images/logo.png
+    - missing.png
+    - packages/other/icon.png
+    - ../outside.png
+  fonts:
+    - family: Inter
+      fonts:
+        - asset: fonts/Inter.ttf
+  shaders:
+    - shaders/blur.frag
+`,
+		"assets/a.txt":           "",
+		"assets/.DS_Store":       "",
+		"assets/2.0x/a.txt":      "",
+		"assets/2.0x/orphan.txt": "",
+		"assets/nested/b.txt":    "",
+		"images/logo.png":        "",
+		"images/other.png":       "",
+		"images/1.5x/logo.png":   "",
+		"images/3.0x/logo.png":   "",
+		"images/dark/logo.png":   "",
+		"fonts/Inter.ttf":        "",
+		"shaders/blur.frag":      "",
+		"shaders/unused.frag":    "",
+		"lib/main.dart":          "",
+	})
+	pubspec, err := ParsePubspecYaml(filepath.Join(dir, "pubspec.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := pubspecDataFiles(dir, pubspec, &FlutterConfig{}, "example")
+	want := []string{
+		"assets/2.0x/a.txt",
+		"assets/a.txt",
+		"fonts/Inter.ttf",
+		"images/1.5x/logo.png",
+		"images/3.0x/logo.png",
+		"images/logo.png",
+		"shaders/blur.frag",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
+
+func TestGenerateRulesSetsDataFromPubspecAssets(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":              "name: example\nenvironment:\n  flutter: \">=3.0.0\"\nflutter:\n  assets:\n    - assets/\n",
+		"lib/main.dart":             "void main() {}\n",
+		"assets/hello.txt":          "",
+		"assets/private/secret.txt": "",
+		"test/main_test.dart":       "void main() {}\n",
+		"pub_deps.json": `{"packages": [
+  {"name": "mockito", "dependency": "direct dev", "source": "hosted", "description": {"name": "mockito", "url": "https://pub.dev"}}
+]}`,
+	})
+
+	result := (&flutterLang{}).GenerateRules(generateArgs(t, dir, "example"))
+	for _, name := range []string{"lib", "lib_dev"} {
+		r := findRule(result.Gen, "flutter_library", name)
+		if r == nil {
+			t.Fatalf("no flutter_library %s generated", name)
+		}
+		if got, want := r.AttrStrings("data"), []string{"assets/hello.txt"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s data: want %v, got %v", name, want, got)
+		}
+	}
+}
+
+// mergedData merges the library generated for the package in dir into a
+// BUILD file whose lib sets data to existing, returning the merged data.
+func mergedData(t *testing.T, dir, existing string) []string {
+	t.Helper()
+	args := generateArgs(t, dir, "example")
+	f, err := rule.LoadData(filepath.Join(dir, "BUILD.bazel"), "example", []byte(`
+flutter_library(
+    name = "lib",
+    srcs = ["lib/main.dart"],
+    data = `+existing+`,
+    pubspec = "pubspec.yaml",
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args.File = f
+	fl := &flutterLang{}
+	res := fl.GenerateRules(args)
+	merger.MergeFile(f, res.Empty, res.Gen, merger.PreResolve, fl.Kinds())
+	return f.Rules[0].AttrStrings("data")
+}
+
+func TestMergeDataKeepsHandWrittenEntries(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":      "name: example\nenvironment:\n  flutter: \">=3.0.0\"\nflutter:\n  assets:\n    - assets/\n",
+		"lib/main.dart":     "void main() {}\n",
+		"assets/a.png":      "",
+		"assets/2.0x/a.png": "",
+		"config.json":       "{}",
+	})
+
+	got := mergedData(t, dir, `["assets/removed.png", "assets/3.0x/removed.png", "config.json"]`)
+	want := []string{"assets/2.0x/a.png", "assets/a.png", "config.json"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("merged data: want %v got %v", want, got)
+	}
+}
+
+func TestMergeDataDropsUndeclaredMissingFiles(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":    "name: example\nenvironment:\n  flutter: \">=3.0.0\"\nflutter:\n  assets:\n    - images/logo.png\n",
+		"lib/main.dart":   "void main() {}\n",
+		"images/logo.png": "",
+		"config.json":     "{}",
+	})
+
+	got := mergedData(t, dir, `["assets/gone.png", "config.json", "generated.json", ":bundle", "//shared:fonts"]`+`
+)
+
+genrule(
+    name = "gen",
+    outs = ["generated.json"],
+    cmd = "echo {} > $@",`)
+	want := []string{"//shared:fonts", ":bundle", "config.json", "generated.json", "images/logo.png"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("merged data: want %v got %v", want, got)
+	}
+}
+
+func TestMergeDataKeepsAttrWithoutFlutterSection(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":  "name: example\nenvironment:\n  flutter: \">=3.0.0\"\n",
+		"lib/main.dart": "void main() {}\n",
+		"config.json":   "{}",
+	})
+
+	got := mergedData(t, dir, `["config.json", "lib/l10n/app_en.arb"]`)
+	if want := []string{"config.json"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("merged data: want %v got %v", want, got)
+	}
+}
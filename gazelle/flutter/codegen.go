@@ -0,0 +1,207 @@
+package flutter
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"gopkg.in/yaml.v3"
+)
+
+// buildRunnerPackage is the pub package that runs Dart code generators.
+const buildRunnerPackage = "build_runner"
+
+// generatedPartSuffixes are the extensions of the part files build_runner
+// generators write next to their sources: source_gen builders such as
+// json_serializable use ".g.dart", freezed ".freezed.dart".
+var generatedPartSuffixes = []string{".g.dart", ".freezed.dart"}
+
+// knownGenerators are build_runner generator packages whose names don't end
+// in one of generatorSuffixes.
+var knownGenerators = map[string]bool{
+	buildRunnerPackage:  true,
+	"drift_dev":         true,
+	"freezed":           true,
+	"json_serializable": true,
+	"source_gen":        true,
+}
+
+// generatorSuffixes are the name endings of build_runner generator packages
+// by convention, as in built_value_generator or flutter_gen_runner.
+var generatorSuffixes = []string{"_generator", "_builder", "_codegen", "_runner"}
+
+// buildRunnerCodegen describes how a package uses build_runner.
+type buildRunnerCodegen struct {
+	// Enabled is set when the package runs build_runner: it declares
+	// generated parts, has a build.yaml or depends on build_runner
+	Enabled bool
+
+	// Parts lists the package-relative generated part files the Dart sources
+	// declare, whether or not they exist
+	Parts []string
+
+	// Suffixes lists the generatedPartSuffixes the parts use
+	Suffixes []string
+
+	// Generators lists the direct dev dependencies the build_runner action
+	// needs: build_runner itself, conventionally named generators and the
+	// packages whose builders build.yaml configures
+	Generators []string
+}
+
+// detectBuildRunner inspects the package in dir for build_runner code
+// generation. regularFiles are the files directly in dir, dart the
+// package-relative Dart sources.
+func detectBuildRunner(dir string, regularFiles, dart []string, pubDeps *PubDeps) buildRunnerCodegen {
+	var codegen buildRunnerCodegen
+	suffixes := make(map[string]bool)
+	for _, src := range dart {
+		content, err := os.ReadFile(filepath.Join(dir, src))
+		if err != nil {
+			continue
+		}
+		for _, d := range ParseDartDirectives(string(content)) {
+			if d.Kind != DartPart || strings.Contains(d.URI, ":") {
+				continue
+			}
+			for _, suffix := range generatedPartSuffixes {
+				if strings.HasSuffix(d.URI, suffix) {
+					codegen.Parts = append(codegen.Parts, path.Join(path.Dir(filepath.ToSlash(src)), d.URI))
+					suffixes[suffix] = true
+					break
+				}
+			}
+		}
+	}
+	sort.Strings(codegen.Parts)
+	for _, suffix := range generatedPartSuffixes {
+		if suffixes[suffix] {
+			codegen.Suffixes = append(codegen.Suffixes, suffix)
+		}
+	}
+
+	direct := GetDirectDependencies(pubDeps)
+	_, hasBuildRunner := direct[buildRunnerPackage]
+	codegen.Enabled = len(codegen.Parts) > 0 || hasBuildRunner
+	configured := make(map[string]bool)
+	for _, f := range regularFiles {
+		if f == "build.yaml" {
+			codegen.Enabled = true
+			configured = configuredBuilderPackages(filepath.Join(dir, f))
+		}
+	}
+	for name, pkg := range direct {
+		if pkg.Dependency == "direct dev" && (isGeneratorPackage(name) || configured[name]) {
+			codegen.Generators = append(codegen.Generators, name)
+		}
+	}
+	sort.Strings(codegen.Generators)
+	return codegen
+}
+
+// isGeneratorPackage reports whether the pub package name belongs to a
+// build_runner generator.
+func isGeneratorPackage(name string) bool {
+	if knownGenerators[name] {
+		return true
+	}
+	for _, suffix := range generatorSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// configuredBuilderPackages returns the packages whose builders a build.yaml
+// configures under targets, keyed "<package>:<builder>", "<package>|<builder>"
+// or "<package>". An unreadable build.yaml configures nothing.
+func configuredBuilderPackages(filename string) map[string]bool {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	var buildYaml struct {
+		Targets map[string]struct {
+			Builders map[string]yaml.Node `yaml:"builders"`
+		} `yaml:"targets"`
+	}
+	if err := yaml.Unmarshal(data, &buildYaml); err != nil {
+		return nil
+	}
+	pkgs := make(map[string]bool)
+	for _, target := range buildYaml.Targets {
+		for key := range target.Builders {
+			pkg, _, _ := strings.Cut(key, ":")
+			pkg, _, _ = strings.Cut(pkg, "|")
+			pkgs[pkg] = true
+		}
+	}
+	return pkgs
+}
+
+// runsInAction reports whether build_runner runs inside the library's build
+// action: the existing rule either doesn't set build_runner_modes yet, in
+// which case it is generated, or lists "build".
+func (codegen buildRunnerCodegen) runsInAction(existing *rule.Rule) bool {
+	if !codegen.Enabled {
+		return false
+	}
+	if existing == nil || existing.Attr("build_runner_modes") == nil {
+		return true
+	}
+	for _, mode := range existing.AttrStrings("build_runner_modes") {
+		if mode == "build" {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutParts returns srcs without the generated parts, which build_runner
+// regenerates in the action. Checked-in copies would clash with its output.
+func (codegen buildRunnerCodegen) withoutParts(srcs []string) []string {
+	parts := make(map[string]bool, len(codegen.Parts))
+	for _, p := range codegen.Parts {
+		parts[p] = true
+	}
+	var kept []string
+	for _, src := range srcs {
+		if !parts[filepath.ToSlash(src)] {
+			kept = append(kept, src)
+		}
+	}
+	return kept
+}
+
+// partExcludes returns glob excludes keeping generated parts out of lib/.
+func (codegen buildRunnerCodegen) partExcludes() []string {
+	var excludes []string
+	for _, suffix := range codegen.Suffixes {
+		excludes = append(excludes, "lib/**/*"+suffix)
+	}
+	return excludes
+}
+
+// generatorLabels returns the labels of the generators among deps, the
+// dev dependency labels generateDeps returns, and deps without them.
+func (codegen buildRunnerCodegen) generatorLabels(pubDeps *PubDeps, deps []string, fc *FlutterConfig, rel string) (generators, rest []string) {
+	direct := GetDirectDependencies(pubDeps)
+	isGenerator := make(map[string]bool, len(codegen.Generators))
+	for _, name := range codegen.Generators {
+		if l := pubDependencyLabel(name, direct[name], fc, rel); l != "" {
+			isGenerator[l] = true
+		}
+	}
+	for _, dep := range deps {
+		if isGenerator[dep] {
+			generators = append(generators, dep)
+		} else {
+			rest = append(rest, dep)
+		}
+	}
+	return generators, rest
+}
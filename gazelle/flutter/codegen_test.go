@@ -0,0 +1,214 @@
+package flutter
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+const codegenPubspec = `name: example
+environment:
+  flutter: ">=3.0.0"
+dependencies:
+  flutter:
+    sdk: flutter
+  json_annotation: ^4.8.0
+dev_dependencies:
+  build_runner: ^2.4.0
+  json_serializable: ^6.7.0
+`
+
+func TestDetectBuildRunner(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"lib/model.dart": `import 'package:json_annotation/json_annotation.dart';
+
+part 'model.g.dart';
+part 'src/model.freezed.dart';
+part 'handwritten_part.dart';
+`,
+		"lib/model.g.dart":    "part of 'model.dart';\n",
+		"lib/src/other.dart":  "// part 'commented.g.dart';\n",
+		"lib/src/nested.dart": "part '../shared.g.dart';\n",
+	})
+	dart := []string{"lib/model.dart", "lib/model.g.dart", "lib/src/nested.dart", "lib/src/other.dart"}
+
+	got := detectBuildRunner(dir, nil, dart, nil)
+	want := buildRunnerCodegen{
+		Enabled:  true,
+		Parts:    []string{"lib/model.g.dart", "lib/shared.g.dart", "lib/src/model.freezed.dart"},
+		Suffixes: []string{".g.dart", ".freezed.dart"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %+v, got %+v", want, got)
+	}
+
+	for _, tc := range []struct {
+		name         string
+		regularFiles []string
+		pubDeps      *PubDeps
+		want         bool
+	}{
+		{name: "plain package"},
+		{name: "build.yaml", regularFiles: []string{"build.yaml", "pubspec.yaml"}, want: true},
+		{
+			name: "build_runner dependency",
+			pubDeps: &PubDeps{Packages: []PubDepsPackage{
+				{Name: "build_runner", Dependency: "direct dev", Source: "hosted"},
+			}},
+			want: true,
+		},
+		{
+			name: "transitive build_runner",
+			pubDeps: &PubDeps{Packages: []PubDepsPackage{
+				{Name: "build_runner", Dependency: "transitive", Source: "hosted"},
+			}},
+		},
+	} {
+		if got := detectBuildRunner(dir, tc.regularFiles, []string{"lib/src/other.dart"}, tc.pubDeps); got.Enabled != tc.want {
+			t.Errorf("%s: Enabled = %v, want %v", tc.name, got.Enabled, tc.want)
+		}
+	}
+}
+
+func TestGenerateRulesConfiguresBuildRunner(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":         codegenPubspec,
+		"lib/model.dart":       "part 'model.g.dart';\n",
+		"lib/model.g.dart":     "part of 'model.dart';\n",
+		"lib/util.g.dart":      "// Not a part of anything.\n",
+		"test/model_test.dart": "void main() {}\n",
+	})
+
+	result := (&flutterLang{}).GenerateRules(generateArgs(t, dir, "example"))
+	lib := findRule(result.Gen, "flutter_library", "lib")
+	if lib == nil {
+		t.Fatal("no flutter_library generated")
+	}
+	if got, want := lib.AttrStrings("build_runner_modes"), []string{"build"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("build_runner_modes: want %v, got %v", want, got)
+	}
+	if got, want := lib.AttrStrings("srcs"), []string{"lib/model.dart", "lib/util.g.dart"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("srcs: want %v, got %v", want, got)
+	}
+	// The action runs the generators, so they join the library and no
+	// lib_dev is needed.
+	wantDeps := []string{
+		"@flutter_sdk//flutter/packages/flutter",
+		"@pub_build_runner//:build_runner",
+		"@pub_json_annotation//:json_annotation",
+		"@pub_json_serializable//:json_serializable",
+	}
+	if got := lib.AttrStrings("deps"); !reflect.DeepEqual(got, wantDeps) {
+		t.Errorf("deps: want %v, got %v", wantDeps, got)
+	}
+	if findRule(result.Gen, "flutter_library", "lib_dev") != nil {
+		t.Error("unexpected lib_dev")
+	}
+}
+
+func TestGenerateRulesKeepsTestDependenciesOffCodegenLibrary(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml": codegenPubspec + `  flutter_test:
+    sdk: flutter
+  flutter_lints: ^3.0.0
+  mockito: ^5.4.0
+  model_builders: ^1.0.0
+`,
+		"build.yaml": `targets:
+  $default:
+    builders:
+      model_builders|models:
+        enabled: true
+`,
+		"lib/model.dart":       "part 'model.g.dart';\n",
+		"test/model_test.dart": "void main() {}\n",
+	})
+
+	result := (&flutterLang{}).GenerateRules(generateArgs(t, dir, "example"))
+	lib := findRule(result.Gen, "flutter_library", "lib")
+	wantDeps := []string{
+		"@flutter_sdk//flutter/packages/flutter",
+		"@pub_build_runner//:build_runner",
+		"@pub_json_annotation//:json_annotation",
+		"@pub_json_serializable//:json_serializable",
+		"@pub_model_builders//:model_builders",
+	}
+	if got := lib.AttrStrings("deps"); !reflect.DeepEqual(got, wantDeps) {
+		t.Errorf("lib deps: want %v, got %v", wantDeps, got)
+	}
+
+	dev := findRule(result.Gen, "flutter_library", "lib_dev")
+	if dev == nil {
+		t.Fatal("no lib_dev generated for the test dependencies")
+	}
+	wantDevDeps := []string{
+		"@flutter_sdk//flutter/packages/flutter",
+		"@flutter_sdk//flutter/packages/flutter_test",
+		"@pub_build_runner//:build_runner",
+		"@pub_flutter_lints//:flutter_lints",
+		"@pub_json_annotation//:json_annotation",
+		"@pub_json_serializable//:json_serializable",
+		"@pub_mockito//:mockito",
+		"@pub_model_builders//:model_builders",
+	}
+	if got := dev.AttrStrings("deps"); !reflect.DeepEqual(got, wantDevDeps) {
+		t.Errorf("lib_dev deps: want %v, got %v", wantDevDeps, got)
+	}
+}
+
+func TestGenerateRulesExcludesGeneratedPartsFromGlob(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":   codegenPubspec,
+		"lib/model.dart": "part 'model.freezed.dart';\n",
+	})
+	args := generateArgs(t, dir, "example")
+	GetFlutterConfig(args.Config).SrcsMode = SrcsModeGlob
+
+	lib := findRule((&flutterLang{}).GenerateRules(args).Gen, "flutter_library", "lib")
+	want := `glob(
+    ["lib/**"],
+    exclude = [
+        "lib/**/#*#",
+        "lib/**/*.freezed.dart",
+        "lib/**/*.swo",
+        "lib/**/*.swp",
+        "lib/**/*~",
+        "lib/**/.*",
+        "lib/**/.*/**",
+    ],
+)`
+	if got := bzl.FormatString(lib.Attr("srcs")); got != want {
+		t.Fatalf("srcs:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGenerateRulesLeavesBuildRunnerModesOutsideTheAction(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":     codegenPubspec,
+		"lib/model.dart":   "part 'model.g.dart';\n",
+		"lib/model.g.dart": "part of 'model.dart';\n",
+	})
+	args := generateArgs(t, dir, "example")
+	f, err := rule.LoadData(filepath.Join(dir, "BUILD.bazel"), "example", []byte(`
+flutter_library(
+    name = "lib",
+    build_runner_modes = ["watch"],
+    pubspec = "pubspec.yaml",
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args.File = f
+
+	lib := findRule((&flutterLang{}).GenerateRules(args).Gen, "flutter_library", "lib")
+	if lib.Attr("build_runner_modes") != nil {
+		t.Errorf("build_runner_modes set to %v", lib.AttrStrings("build_runner_modes"))
+	}
+	if got, want := lib.AttrStrings("srcs"), []string{"lib/model.dart", "lib/model.g.dart"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("srcs: want %v, got %v", want, got)
+	}
+}
@@ -1,13 +1,21 @@
 package flutter
 
 import (
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
 	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 )
 
 // Gazelle directives for Flutter
 const (
-	// DirectiveExclude excludes directories from Flutter rule generation
+	// DirectiveExclude excludes directories and files matching a glob,
+	// relative to the declaring directory, from Flutter rule generation
 	DirectiveExclude = "flutter_exclude"
 
 	// DirectiveLibraryName overrides the default "lib" name for flutter_library
@@ -18,12 +26,90 @@ const (
 
 	// DirectiveSDKRepo overrides the repository label used for Flutter SDK deps
 	DirectiveSDKRepo = "flutter_sdk_repo"
+
+	// DirectiveDepsMode selects where library deps come from: pub_deps.json
+	// or the package: imports of the library sources
+	DirectiveDepsMode = "flutter_deps_mode"
+
+	// DirectiveDevDeps controls whether dev dependencies are split into a
+	// testonly library or merged into the package library
+	DirectiveDevDeps = "flutter_dev_deps"
+
+	// DirectiveSrcsMode selects whether library srcs are written as a file
+	// list or as a glob
+	DirectiveSrcsMode = "flutter_srcs_mode"
+
+	// DirectiveHostedRepo maps a pub server URL to a repository prefix
+	// (ending in "_") or to a hub repository
+	DirectiveHostedRepo = "flutter_hosted_repo"
+
+	// DirectiveResolve pins the label a Dart package resolves to
+	DirectiveResolve = "flutter_resolve"
+
+	// DirectivePathRepo maps a directory outside the workspace to the
+	// repository that provides it
+	DirectivePathRepo = "flutter_path_repo"
+
+	// DirectiveSDKPackage maps an SDK package to its directory in the SDK
+	// repository
+	DirectiveSDKPackage = "flutter_sdk_package"
+
+	// DirectiveAnalyze sets the lowest issue severity that fails generated
+	// flutter_analyze_test targets, or turns them off
+	DirectiveAnalyze = "flutter_analyze"
+
+	// DirectiveFormatCheck controls whether to generate dart_format_test
+	// targets
+	DirectiveFormatCheck = "flutter_format_check"
+)
+
+// Values accepted by the flutter_deps_mode directive
+const (
+	// DepsModePubDeps derives deps from the direct dependencies in pub_deps.json
+	DepsModePubDeps = "pub_deps"
+
+	// DepsModeImports resolves the package: imports found in library sources
+	DepsModeImports = "imports"
+)
+
+// Values accepted by the flutter_dev_deps directive
+const (
+	// DevDepsSplit puts dev dependencies on a testonly library embedded by tests
+	DevDepsSplit = "split"
+
+	// DevDepsMerge adds dev dependencies to the package library itself
+	DevDepsMerge = "merge"
+)
+
+// Values accepted by the flutter_srcs_mode directive
+const (
+	// SrcsModeList lists every library source file explicitly
+	SrcsModeList = "list"
+
+	// SrcsModeGlob writes library srcs as a glob over lib/
+	SrcsModeGlob = "glob"
+)
+
+// Values accepted by the flutter_analyze directive
+const (
+	// AnalyzeInfos fails analysis on infos, warnings and errors
+	AnalyzeInfos = "infos"
+
+	// AnalyzeWarnings fails analysis on warnings and errors, like flutter
+	// analyze does by default
+	AnalyzeWarnings = "warnings"
+
+	// AnalyzeErrors fails analysis on errors only
+	AnalyzeErrors = "errors"
+
+	// AnalyzeOff generates no flutter_analyze_test
+	AnalyzeOff = "off"
 )
 
 // FlutterConfig contains Flutter-specific configuration
 type FlutterConfig struct {
-	// Exclude patterns for directories to skip
-	Exclude []string
+	// Exclude patterns for directories and files to skip
+	Exclude []ExcludePattern
 
 	// LibraryName override for flutter_library targets
 	LibraryName string
@@ -33,6 +119,62 @@ type FlutterConfig struct {
 
 	// SDKRepo is the repository prefix used for sdk-based dependencies
 	SDKRepo string
+
+	// DepsMode is DepsModePubDeps or DepsModeImports; empty means DepsModePubDeps
+	DepsMode string
+
+	// DevDeps is DevDepsSplit or DevDepsMerge; empty means DevDepsSplit
+	DevDeps string
+
+	// SrcsMode is SrcsModeList or SrcsModeGlob; empty means SrcsModeList
+	SrcsMode string
+
+	// Analyze is AnalyzeInfos, AnalyzeWarnings, AnalyzeErrors or AnalyzeOff;
+	// empty means AnalyzeWarnings
+	Analyze string
+
+	// FormatCheck controls whether to generate dart_format_test targets
+	FormatCheck bool
+
+	// HostedRepos maps normalized pub server URLs to a repository prefix such
+	// as "@corp_pub_" or a hub repository such as "@corp_pub"
+	HostedRepos map[string]string
+
+	// Resolves maps Dart package names to labels set by flutter_resolve
+	Resolves map[string]label.Label
+
+	// PathRepos maps directories outside the workspace, relative to the
+	// repository root, to the repositories providing them, such as "@shared"
+	PathRepos map[string]string
+
+	// SDKPackages maps SDK package names to their directories in the SDK
+	// repository, on top of the built-in table
+	SDKPackages map[string]string
+
+	// moduleSDKRepo is the SDK repository the root MODULE.bazel imports from
+	// the flutter extension, if it could be determined
+	moduleSDKRepo string
+
+	// flutterRepos maps the repositories the root MODULE.bazel imports from
+	// the flutter extension to their apparent names
+	flutterRepos map[string]string
+
+	// bazelIgnored lists the repository-relative directories in .bazelignore
+	bazelIgnored []string
+
+	// pubRepos is shared by all configurations and records the pub
+	// repositories generated labels refer to
+	pubRepos *pubRepoTracker
+}
+
+// ExcludePattern is a flutter_exclude glob together with the directory of
+// the BUILD file that declared it.
+type ExcludePattern struct {
+	// Dir is the slash-separated, repository-relative declaring directory
+	Dir string
+
+	// Pattern is the glob, relative to Dir
+	Pattern string
 }
 
 // GetFlutterConfig returns the FlutterConfig for a given config.Config
@@ -54,6 +196,15 @@ func (fc *FlutterConfig) KnownDirectives() []string {
 		DirectiveLibraryName,
 		DirectiveGenerate,
 		DirectiveSDKRepo,
+		DirectiveDepsMode,
+		DirectiveDevDeps,
+		DirectiveSrcsMode,
+		DirectiveAnalyze,
+		DirectiveFormatCheck,
+		DirectiveHostedRepo,
+		DirectiveResolve,
+		DirectivePathRepo,
+		DirectiveSDKPackage,
 	}
 }
 
@@ -67,7 +218,16 @@ func (fc *FlutterConfig) Configure(c *config.Config, rel string, f *rule.File) {
 	for _, d := range f.Directives {
 		switch d.Key {
 		case DirectiveExclude:
-			fc.Exclude = append(fc.Exclude, d.Value)
+			pattern := strings.TrimPrefix(path.Clean(d.Value), "./")
+			if d.Value == "" {
+				log.Printf("%s: %s requires a pattern", f.Path, DirectiveExclude)
+				continue
+			}
+			if err := validateGlob(pattern); err != nil {
+				log.Printf("%s: invalid pattern %q for %s: %v", f.Path, d.Value, DirectiveExclude, err)
+				continue
+			}
+			fc.Exclude = append(fc.Exclude, ExcludePattern{Dir: rel, Pattern: pattern})
 		case DirectiveLibraryName:
 			fc.LibraryName = d.Value
 		case DirectiveGenerate:
@@ -75,9 +235,98 @@ func (fc *FlutterConfig) Configure(c *config.Config, rel string, f *rule.File) {
 		case DirectiveSDKRepo:
 			if d.Value != "" {
 				fc.SDKRepo = d.Value
+			} else if fc.moduleSDKRepo != "" {
+				fc.SDKRepo = fc.moduleSDKRepo
 			} else {
 				fc.SDKRepo = defaultSDKRepo(c)
 			}
+		case DirectiveDepsMode:
+			switch d.Value {
+			case DepsModePubDeps, DepsModeImports:
+				fc.DepsMode = d.Value
+			default:
+				log.Printf("%s: invalid value %q for %s; expected %q or %q", f.Path, d.Value, DirectiveDepsMode, DepsModePubDeps, DepsModeImports)
+			}
+		case DirectiveDevDeps:
+			switch d.Value {
+			case DevDepsSplit, DevDepsMerge:
+				fc.DevDeps = d.Value
+			default:
+				log.Printf("%s: invalid value %q for %s; expected %q or %q", f.Path, d.Value, DirectiveDevDeps, DevDepsSplit, DevDepsMerge)
+			}
+		case DirectiveSrcsMode:
+			switch d.Value {
+			case SrcsModeList, SrcsModeGlob:
+				fc.SrcsMode = d.Value
+			default:
+				log.Printf("%s: invalid value %q for %s; expected %q or %q", f.Path, d.Value, DirectiveSrcsMode, SrcsModeList, SrcsModeGlob)
+			}
+		case DirectiveAnalyze:
+			switch d.Value {
+			case AnalyzeInfos, AnalyzeWarnings, AnalyzeErrors, AnalyzeOff:
+				fc.Analyze = d.Value
+			default:
+				log.Printf("%s: invalid value %q for %s; expected %q, %q, %q or %q", f.Path, d.Value, DirectiveAnalyze, AnalyzeInfos, AnalyzeWarnings, AnalyzeErrors, AnalyzeOff)
+			}
+		case DirectiveFormatCheck:
+			fc.FormatCheck = d.Value == "true" || d.Value == "yes" || d.Value == "1"
+		case DirectiveHostedRepo:
+			fields := strings.Fields(d.Value)
+			if len(fields) != 2 || !strings.HasPrefix(fields[1], "@") || len(fields[1]) == 1 {
+				log.Printf("%s: invalid value %q for %s; expected \"<url> @<repo_prefix_>\" or \"<url> @<hub_repo>\"", f.Path, d.Value, DirectiveHostedRepo)
+				continue
+			}
+			hostedRepos := make(map[string]string, len(fc.HostedRepos)+1)
+			for url, repo := range fc.HostedRepos {
+				hostedRepos[url] = repo
+			}
+			hostedRepos[normalizeHostedURL(fields[0])] = fields[1]
+			fc.HostedRepos = hostedRepos
+		case DirectiveResolve:
+			fields := strings.Fields(d.Value)
+			if len(fields) != 2 {
+				log.Printf("%s: invalid value %q for %s; expected \"<package> <label>\"", f.Path, d.Value, DirectiveResolve)
+				continue
+			}
+			l, err := label.Parse(fields[1])
+			if err != nil {
+				log.Printf("%s: invalid label %q for %s: %v", f.Path, fields[1], DirectiveResolve, err)
+				continue
+			}
+			resolves := make(map[string]label.Label, len(fc.Resolves)+1)
+			for pkg, l := range fc.Resolves {
+				resolves[pkg] = l
+			}
+			resolves[fields[0]] = l.Abs("", rel)
+			fc.Resolves = resolves
+		case DirectivePathRepo:
+			fields := strings.Fields(d.Value)
+			if len(fields) != 2 || !strings.HasPrefix(fields[1], "@") || len(fields[1]) == 1 {
+				log.Printf("%s: invalid value %q for %s; expected \"<path> @<repo>\"", f.Path, d.Value, DirectivePathRepo)
+				continue
+			}
+			dir := filepath.ToSlash(fields[0])
+			if !path.IsAbs(dir) {
+				dir = path.Join(rel, dir)
+			}
+			fc.addPathRepos(map[string]string{path.Clean(dir): fields[1]})
+		case DirectiveSDKPackage:
+			fields := strings.Fields(d.Value)
+			if len(fields) != 2 {
+				log.Printf("%s: invalid value %q for %s; expected \"<package> <path>\"", f.Path, d.Value, DirectiveSDKPackage)
+				continue
+			}
+			dir := path.Clean(fields[1])
+			if dir == "." || path.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, "../") {
+				log.Printf("%s: invalid path %q for %s; expected a directory in the SDK repository", f.Path, fields[1], DirectiveSDKPackage)
+				continue
+			}
+			sdkPackages := make(map[string]string, len(fc.SDKPackages)+1)
+			for pkg, dir := range fc.SDKPackages {
+				sdkPackages[pkg] = dir
+			}
+			sdkPackages[fields[0]] = dir
+			fc.SDKPackages = sdkPackages
 		}
 	}
 }
@@ -85,24 +334,124 @@ func (fc *FlutterConfig) Configure(c *config.Config, rel string, f *rule.File) {
 // Clone creates a copy of the configuration
 func (fc *FlutterConfig) Clone() *FlutterConfig {
 	return &FlutterConfig{
-		Exclude:     append([]string{}, fc.Exclude...),
+		Exclude:     append([]ExcludePattern{}, fc.Exclude...),
 		LibraryName: fc.LibraryName,
 		Generate:    fc.Generate,
 		SDKRepo:     fc.SDKRepo,
+		DepsMode:    fc.DepsMode,
+		DevDeps:     fc.DevDeps,
+		SrcsMode:    fc.SrcsMode,
+		Analyze:     fc.Analyze,
+		FormatCheck: fc.FormatCheck,
+		HostedRepos: fc.HostedRepos,
+		Resolves:    fc.Resolves,
+		PathRepos:   fc.PathRepos,
+		SDKPackages: fc.SDKPackages,
+
+		moduleSDKRepo: fc.moduleSDKRepo,
+		flutterRepos:  fc.flutterRepos,
+		bazelIgnored:  fc.bazelIgnored,
+		pubRepos:      fc.pubRepos,
+	}
+}
+
+// configureModule applies what the root MODULE.bazel says about the
+// workspace: the apparent name of the Flutter SDK repository, the modules
+// local_path_override directories provide and the imported pub repositories.
+func (fc *FlutterConfig) configureModule(c *config.Config) {
+	filename := filepath.Join(c.RepoRoot, "MODULE.bazel")
+	m, err := loadModuleFile(c.RepoRoot)
+	if err != nil {
+		log.Printf("%s: %v", filename, err)
+		return
+	}
+	if m == nil {
+		return
 	}
+	fc.pubRepos.configure(filename, m)
+	fc.flutterRepos = m.extensionRepos["flutter"]
+	if repo := m.sdkRepo(); repo != "" {
+		fc.moduleSDKRepo = "@" + repo
+		fc.SDKRepo = fc.moduleSDKRepo
+	}
+	fc.addPathRepos(m.pathRepos())
 }
 
-// IsExcluded checks if a directory should be excluded
-func (fc *FlutterConfig) IsExcluded(dir string) bool {
-	for _, pattern := range fc.Exclude {
-		if pattern == dir {
-			return true
+// addPathRepos adds path-to-repository mappings without modifying maps shared
+// with parent configurations.
+func (fc *FlutterConfig) addPathRepos(add map[string]string) {
+	if len(add) == 0 {
+		return
+	}
+	pathRepos := make(map[string]string, len(fc.PathRepos)+len(add))
+	for dir, repo := range fc.PathRepos {
+		pathRepos[dir] = repo
+	}
+	for dir, repo := range add {
+		pathRepos[dir] = repo
+	}
+	fc.PathRepos = pathRepos
+}
+
+// pathRepoLabel returns the label of the library at dir, a cleaned path
+// outside the workspace, in the repository mapped to the closest enclosing
+// flutter_path_repo or local_path_override directory.
+func (fc *FlutterConfig) pathRepoLabel(dir string) (label.Label, bool) {
+	best := ""
+	for root := range fc.PathRepos {
+		if (dir == root || strings.HasPrefix(dir, root+"/")) && len(root) > len(best) {
+			best = root
+		}
+	}
+	if best == "" {
+		return label.NoLabel, false
+	}
+	repo := strings.TrimPrefix(fc.PathRepos[best], "@")
+	pkg := strings.TrimPrefix(strings.TrimPrefix(dir, best), "/")
+	return label.New(repo, pkg, fc.LibraryName), true
+}
+
+// IsExcluded reports whether the repository-relative path rel, or any
+// directory above it, matches a flutter_exclude pattern. Patterns only apply
+// to paths at or below the directory that declared them.
+func (fc *FlutterConfig) IsExcluded(rel string) bool {
+	for _, ex := range fc.Exclude {
+		var sub string
+		switch {
+		case ex.Dir == "":
+			sub = rel
+		case rel == ex.Dir:
+			sub = ""
+		case strings.HasPrefix(rel, ex.Dir+"/"):
+			sub = rel[len(ex.Dir)+1:]
+		default:
+			continue
+		}
+		segs := splitPath(sub)
+		for i := 0; i <= len(segs); i++ {
+			if matchGlob(ex.Pattern, strings.Join(segs[:i], "/")) {
+				return true
+			}
 		}
 	}
 	return false
 }
 
-// defaultSDKRepo returns the repository label prefix for Flutter SDK packages.
+// excludeFilter returns a walkDirFiltered predicate that skips files and
+// directories excluded by flutter_exclude or .bazelignore. rel is the
+// repository-relative path of the walk's base directory.
+func (fc *FlutterConfig) excludeFilter(rel string) func(relPath string, info os.FileInfo) bool {
+	if len(fc.Exclude) == 0 && len(fc.bazelIgnored) == 0 {
+		return nil
+	}
+	return func(relPath string, info os.FileInfo) bool {
+		p := path.Join(rel, filepath.ToSlash(relPath))
+		return fc.isBazelIgnored(p) || fc.IsExcluded(p)
+	}
+}
+
+// defaultSDKRepo returns the repository label prefix for Flutter SDK packages
+// when the root MODULE.bazel doesn't reveal it.
 //
 // Generated BUILD files reference the SDK by its apparent name, "@flutter_sdk",
 // which every consuming module exposes via use_repo(flutter, "flutter_sdk").
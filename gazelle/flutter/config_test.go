@@ -1,9 +1,11 @@
 package flutter
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
 )
 
 func TestDefaultSDKRepoIsApparentName(t *testing.T) {
@@ -21,13 +23,188 @@ func TestDefaultSDKRepoIsApparentName(t *testing.T) {
 
 func TestSDKRepoDirectiveOverrides(t *testing.T) {
 	fc := &FlutterConfig{SDKRepo: "@flutter_sdk"}
-	if got := sdkDependencyLabel("flutter", fc); got != "@flutter_sdk//flutter/packages/flutter:flutter" {
+	if got, _ := sdkDependencyLabel("flutter", fc); got != "@flutter_sdk//flutter/packages/flutter" {
 		t.Fatalf("unexpected sdk label before override: %q", got)
 	}
 
 	// An explicit, non-empty flutter_sdk_repo directive wins.
 	fc.SDKRepo = "@my_flutter"
-	if got := sdkDependencyLabel("flutter", fc); got != "@my_flutter//flutter/packages/flutter:flutter" {
+	if got, _ := sdkDependencyLabel("flutter", fc); got != "@my_flutter//flutter/packages/flutter" {
 		t.Fatalf("directive override not applied: %q", got)
 	}
 }
+
+func TestSDKPackageDirective(t *testing.T) {
+	c := &config.Config{}
+	root := &FlutterConfig{SDKRepo: "@flutter_sdk"}
+	root.Configure(c, "", &rule.File{Path: "BUILD.bazel", Directives: []rule.Directive{
+		{Key: DirectiveSDKPackage, Value: "flutter_gpu flutter/packages/flutter_gpu"},
+		{Key: DirectiveSDKPackage, Value: "sky_engine ../elsewhere"},
+	}})
+
+	child := root.Clone()
+	child.Configure(c, "app", &rule.File{Path: "app/BUILD.bazel", Directives: []rule.Directive{
+		{Key: DirectiveSDKPackage, Value: "flutter_test ./third_party/flutter_test/"},
+	}})
+
+	if got, ok := sdkDependencyLabel("flutter_gpu", child); !ok || got != "@flutter_sdk//flutter/packages/flutter_gpu" {
+		t.Fatalf("inherited mapping: got %q, %v", got, ok)
+	}
+	if got, _ := sdkDependencyLabel("flutter_test", child); got != "@flutter_sdk//third_party/flutter_test" {
+		t.Fatalf("overridden mapping: got %q", got)
+	}
+	if got, _ := sdkDependencyLabel("flutter_test", root); got != "@flutter_sdk//flutter/packages/flutter_test" {
+		t.Fatalf("child directive leaked into parent: got %q", got)
+	}
+	if got, _ := sdkDependencyLabel("sky_engine", root); got != "@flutter_sdk//flutter/bin/cache/pkg/sky_engine" {
+		t.Fatalf("invalid path was accepted: got %q", got)
+	}
+	if _, ok := sdkDependencyLabel("flutter_gpu", &FlutterConfig{SDKRepo: "@flutter_sdk"}); ok {
+		t.Fatalf("flutter_gpu should be unknown without a directive")
+	}
+}
+
+func TestExcludePatternsAreRelativeToDeclaringDirectory(t *testing.T) {
+	fc := &FlutterConfig{}
+	fc.Configure(&config.Config{}, "", &rule.File{Path: "BUILD.bazel", Directives: []rule.Directive{
+		{Key: DirectiveExclude, Value: "**/example"},
+	}})
+	fc.Configure(&config.Config{}, "packages", &rule.File{Path: "packages/BUILD.bazel", Directives: []rule.Directive{
+		{Key: DirectiveExclude, Value: "third_party/**"},
+		{Key: DirectiveExclude, Value: "./legacy"},
+		{Key: DirectiveExclude, Value: "bad/[x"},
+	}})
+	if len(fc.Exclude) != 3 {
+		t.Fatalf("expected the malformed pattern to be dropped, got %v", fc.Exclude)
+	}
+
+	for rel, want := range map[string]bool{
+		"example":                         true,
+		"packages/foo/example":            true,
+		"packages/foo/example/lib/a.dart": true,
+		"packages/third_party":            true,
+		"packages/third_party/x/lib":      true,
+		"third_party/x":                   false,
+		"packages/legacy":                 true,
+		"packages/legacy/lib/a.dart":      true,
+		"legacy":                          false,
+		"packages/foo":                    false,
+	} {
+		if got := fc.IsExcluded(rel); got != want {
+			t.Errorf("IsExcluded(%q) = %v, want %v", rel, got, want)
+		}
+	}
+}
+
+func TestHostedRepoDirective(t *testing.T) {
+	parent := &FlutterConfig{}
+	parent.Configure(&config.Config{}, "", &rule.File{Path: "BUILD.bazel", Directives: []rule.Directive{
+		{Key: DirectiveHostedRepo, Value: "https://pub.corp.example/ @corp_pub_"},
+		{Key: DirectiveHostedRepo, Value: "https://pub.corp.example"},
+	}})
+	child := parent.Clone()
+	child.Configure(&config.Config{}, "apps", &rule.File{Path: "apps/BUILD.bazel", Directives: []rule.Directive{
+		{Key: DirectiveHostedRepo, Value: "https://hub.corp.example @corp_hub"},
+	}})
+
+	if want := map[string]string{"https://pub.corp.example": "@corp_pub_"}; !reflect.DeepEqual(parent.HostedRepos, want) {
+		t.Fatalf("parent HostedRepos: want %v got %v", want, parent.HostedRepos)
+	}
+	if got := child.HostedRepos["https://hub.corp.example"]; got != "@corp_hub" {
+		t.Fatalf("child mapping missing: %v", child.HostedRepos)
+	}
+	if got := child.HostedRepos["https://pub.corp.example"]; got != "@corp_pub_" {
+		t.Fatalf("child did not inherit parent mapping: %v", child.HostedRepos)
+	}
+}
+
+func TestResolveDirectiveIsInheritedAndRelativeToDeclaringDirectory(t *testing.T) {
+	parent := &FlutterConfig{}
+	parent.Configure(&config.Config{}, "third_party", &rule.File{Path: "third_party/BUILD.bazel", Directives: []rule.Directive{
+		{Key: DirectiveResolve, Value: "foo //third_party/dart/foo:lib"},
+		{Key: DirectiveResolve, Value: "bar :wrapped_bar"},
+		{Key: DirectiveResolve, Value: "baz"},
+	}})
+	child := parent.Clone()
+	child.Configure(&config.Config{}, "apps", &rule.File{Path: "apps/BUILD.bazel", Directives: []rule.Directive{
+		{Key: DirectiveResolve, Value: "foo @vendored_foo//:foo"},
+	}})
+
+	want := map[string]string{"foo": "//third_party/dart/foo:lib", "bar": "//third_party:wrapped_bar"}
+	got := map[string]string{}
+	for pkg, l := range parent.Resolves {
+		got[pkg] = l.String()
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parent Resolves: want %v got %v", want, got)
+	}
+	if got := child.Resolves["foo"].String(); got != "@vendored_foo//:foo" {
+		t.Fatalf("child override not applied: %s", got)
+	}
+	if got := child.Resolves["bar"].String(); got != "//third_party:wrapped_bar" {
+		t.Fatalf("child did not inherit parent resolve: %s", got)
+	}
+}
+
+func TestPathReposFromModuleFileAndDirective(t *testing.T) {
+	root := writePackage(t, map[string]string{
+		"MODULE.bazel": `bazel_dep(name = "shared_models", version = "0.0.0", repo_name = "shared")
+local_path_override(
+    module_name = "shared_models",
+    path = "../shared",
+)
+
+bazel_dep(name = "tools", version = "0.0.0")
+local_path_override(module_name = "tools", path = "../tools/")
+
+local_path_override(module_name = "not_a_dep", path = "../other")
+`,
+	})
+	c := resolveTestConfig(t)
+	c.RepoRoot = root
+
+	fl := &flutterLang{}
+	fl.Configure(c, "", nil)
+	want := map[string]string{"../shared": "@shared", "../tools": "@tools"}
+	if got := GetFlutterConfig(c).PathRepos; !reflect.DeepEqual(got, want) {
+		t.Fatalf("PathRepos from MODULE.bazel: want %v got %v", want, got)
+	}
+
+	fl.Configure(c, "apps", &rule.File{Path: "apps/BUILD.bazel", Directives: []rule.Directive{
+		{Key: DirectivePathRepo, Value: "../../vendor/dart @vendored_dart"},
+	}})
+	if got := GetFlutterConfig(c).PathRepos["../vendor/dart"]; got != "@vendored_dart" {
+		t.Fatalf("flutter_path_repo not applied: %v", GetFlutterConfig(c).PathRepos)
+	}
+}
+
+func TestSDKRepoFromModuleFile(t *testing.T) {
+	root := writePackage(t, map[string]string{
+		"MODULE.bazel": `bazel_dep(name = "rules_flutter", version = "0.2.1")
+flutter = use_extension("@rules_flutter//flutter:extensions.bzl", "flutter")
+use_repo(flutter, my_sdk = "flutter_sdk")
+`,
+	})
+	c := resolveTestConfig(t)
+	c.RepoRoot = root
+
+	fl := &flutterLang{}
+	fl.Configure(c, "", nil)
+	if got := GetFlutterConfig(c).SDKRepo; got != "@my_sdk" {
+		t.Fatalf("SDKRepo from MODULE.bazel = %q, want %q", got, "@my_sdk")
+	}
+
+	fl.Configure(c, "apps", &rule.File{Path: "apps/BUILD.bazel", Directives: []rule.Directive{
+		{Key: DirectiveSDKRepo, Value: "@pinned_sdk"},
+	}})
+	if got := GetFlutterConfig(c).SDKRepo; got != "@pinned_sdk" {
+		t.Fatalf("flutter_sdk_repo directive not applied: %q", got)
+	}
+
+	fl.Configure(c, "apps/reset", &rule.File{Path: "apps/reset/BUILD.bazel", Directives: []rule.Directive{
+		{Key: DirectiveSDKRepo, Value: ""},
+	}})
+	if got := GetFlutterConfig(c).SDKRepo; got != "@my_sdk" {
+		t.Fatalf("empty flutter_sdk_repo should restore the detected repo, got %q", got)
+	}
+}
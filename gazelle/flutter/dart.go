@@ -0,0 +1,433 @@
+package flutter
+
+import (
+	"strings"
+)
+
+// DartDirectiveKind identifies a Dart namespace directive.
+type DartDirectiveKind string
+
+// Directive kinds recognized by ParseDartDirectives
+const (
+	DartImport DartDirectiveKind = "import"
+	DartExport DartDirectiveKind = "export"
+	DartPart   DartDirectiveKind = "part"
+	DartPartOf DartDirectiveKind = "part of"
+)
+
+// DartConfiguration is one `if (test) 'uri'` alternative of a conditional
+// import or export.
+type DartConfiguration struct {
+	// Test is the dotted environment name, e.g. "dart.library.io"
+	Test string
+
+	// Value is the compared string for `if (name == 'value')` tests, or empty
+	Value string
+
+	// URI is the alternative URI used when the test holds
+	URI string
+}
+
+// DartDirective is a single import, export, part or part of directive.
+type DartDirective struct {
+	Kind DartDirectiveKind
+
+	// URI is the quoted target. For `part of` it is empty when the directive
+	// names a library instead of a URI.
+	URI string
+
+	// LibraryName is the dotted library name of a `part of name;` directive
+	LibraryName string
+
+	// Configurations lists conditional import/export alternatives
+	Configurations []DartConfiguration
+
+	// Deferred is set for `import '...' deferred as prefix`
+	Deferred bool
+
+	// Prefix is the `as` prefix of an import
+	Prefix string
+
+	// Show and Hide list the combinator names of an import or export
+	Show []string
+	Hide []string
+}
+
+// URIs returns the directive URI followed by its conditional alternatives.
+func (d DartDirective) URIs() []string {
+	var uris []string
+	if d.URI != "" {
+		uris = append(uris, d.URI)
+	}
+	for _, cfg := range d.Configurations {
+		if cfg.URI != "" {
+			uris = append(uris, cfg.URI)
+		}
+	}
+	return uris
+}
+
+// ParseDartDirectives scans the header of a Dart compilation unit and returns
+// its import, export, part and part of directives in source order.
+//
+// Dart only allows directives before the first declaration, so scanning stops
+// at the first token that is neither a directive nor metadata. Comments
+// (including nested block comments) and string literals of every form are
+// tokenized properly, so directive-like text inside them is ignored.
+func ParseDartDirectives(content string) []DartDirective {
+	p := &dartParser{lex: &dartLexer{src: content}}
+	p.lex.skipScriptTag()
+	return p.parse()
+}
+
+type dartTokenKind int
+
+const (
+	dartEOF dartTokenKind = iota
+	dartIdent
+	dartString
+	dartPunct
+)
+
+type dartToken struct {
+	kind  dartTokenKind
+	text  string
+	value string // decoded value of string literals
+}
+
+type dartLexer struct {
+	src string
+	pos int
+}
+
+// skipScriptTag skips a leading `#!` line.
+func (l *dartLexer) skipScriptTag() {
+	if strings.HasPrefix(l.src, "#!") {
+		if i := strings.IndexByte(l.src, '\n'); i >= 0 {
+			l.pos = i + 1
+		} else {
+			l.pos = len(l.src)
+		}
+	}
+}
+
+// skipTrivia skips whitespace and comments. Dart block comments nest.
+func (l *dartLexer) skipTrivia() {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "//"):
+			if i := strings.IndexByte(l.src[l.pos:], '\n'); i >= 0 {
+				l.pos += i + 1
+			} else {
+				l.pos = len(l.src)
+			}
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			l.pos += 2
+			depth := 1
+			for l.pos < len(l.src) && depth > 0 {
+				switch {
+				case strings.HasPrefix(l.src[l.pos:], "/*"):
+					depth++
+					l.pos += 2
+				case strings.HasPrefix(l.src[l.pos:], "*/"):
+					depth--
+					l.pos += 2
+				default:
+					l.pos++
+				}
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isDartIdentStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDartIdentPart(c byte) bool {
+	return isDartIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+// next returns the next token.
+func (l *dartLexer) next() dartToken {
+	l.skipTrivia()
+	if l.pos >= len(l.src) {
+		return dartToken{kind: dartEOF}
+	}
+
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case (c == 'r' || c == 'R') && l.pos+1 < len(l.src) && (l.src[l.pos+1] == '\'' || l.src[l.pos+1] == '"'):
+		l.pos++
+		value := l.scanString(true)
+		return dartToken{kind: dartString, text: l.src[start:l.pos], value: value}
+	case c == '\'' || c == '"':
+		value := l.scanString(false)
+		return dartToken{kind: dartString, text: l.src[start:l.pos], value: value}
+	case isDartIdentStart(c):
+		for l.pos < len(l.src) && isDartIdentPart(l.src[l.pos]) {
+			l.pos++
+		}
+		return dartToken{kind: dartIdent, text: l.src[start:l.pos]}
+	case strings.HasPrefix(l.src[l.pos:], "=="):
+		l.pos += 2
+		return dartToken{kind: dartPunct, text: "=="}
+	default:
+		l.pos++
+		return dartToken{kind: dartPunct, text: string(c)}
+	}
+}
+
+// scanString scans a string literal starting at its opening quote and
+// returns its decoded value. Interpolations are skipped and do not
+// contribute to the value.
+func (l *dartLexer) scanString(raw bool) string {
+	quote := l.src[l.pos : l.pos+1]
+	if strings.HasPrefix(l.src[l.pos:], quote+quote+quote) {
+		quote = quote + quote + quote
+	}
+	l.pos += len(quote)
+	multiline := len(quote) == 3
+
+	var value strings.Builder
+	for l.pos < len(l.src) {
+		if strings.HasPrefix(l.src[l.pos:], quote) {
+			l.pos += len(quote)
+			return value.String()
+		}
+		c := l.src[l.pos]
+		switch {
+		case c == '\n' && !multiline:
+			// Unterminated single-line string.
+			return value.String()
+		case c == '\\' && !raw && l.pos+1 < len(l.src):
+			value.WriteByte(decodeDartEscape(l.src[l.pos+1]))
+			l.pos += 2
+		case c == '$' && !raw && l.pos+1 < len(l.src) && l.src[l.pos+1] == '{':
+			l.pos += 2
+			l.skipInterpolation()
+		default:
+			value.WriteByte(c)
+			l.pos++
+		}
+	}
+	return value.String()
+}
+
+// skipInterpolation skips a `${...}` expression, including nested strings
+// and braces, leaving the lexer after the closing brace.
+func (l *dartLexer) skipInterpolation() {
+	depth := 1
+	for depth > 0 {
+		tok := l.next()
+		switch {
+		case tok.kind == dartEOF:
+			return
+		case tok.kind == dartPunct && tok.text == "{":
+			depth++
+		case tok.kind == dartPunct && tok.text == "}":
+			depth--
+		}
+	}
+}
+
+func decodeDartEscape(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 't':
+		return '\t'
+	case 'r':
+		return '\r'
+	default:
+		return c
+	}
+}
+
+type dartParser struct {
+	lex    *dartLexer
+	peeked *dartToken
+}
+
+func (p *dartParser) next() dartToken {
+	if p.peeked != nil {
+		tok := *p.peeked
+		p.peeked = nil
+		return tok
+	}
+	return p.lex.next()
+}
+
+func (p *dartParser) peek() dartToken {
+	if p.peeked == nil {
+		tok := p.lex.next()
+		p.peeked = &tok
+	}
+	return *p.peeked
+}
+
+func (p *dartParser) parse() []DartDirective {
+	var directives []DartDirective
+	for {
+		tok := p.next()
+		switch {
+		case tok.kind == dartPunct && tok.text == "@":
+			p.skipMetadata()
+		case tok.kind == dartIdent && tok.text == "library":
+			p.skipStatement()
+		case tok.kind == dartIdent && (tok.text == "import" || tok.text == "export"):
+			d := DartDirective{Kind: DartImport}
+			if tok.text == "export" {
+				d.Kind = DartExport
+			}
+			d.URI = p.stringLiteral()
+			p.parseClauses(&d)
+			directives = append(directives, d)
+		case tok.kind == dartIdent && tok.text == "part":
+			d := DartDirective{Kind: DartPart}
+			if next := p.peek(); next.kind == dartIdent && next.text == "of" {
+				p.next()
+				d.Kind = DartPartOf
+				if p.peek().kind == dartString {
+					d.URI = p.stringLiteral()
+				} else {
+					d.LibraryName = p.dottedName()
+				}
+			} else {
+				d.URI = p.stringLiteral()
+			}
+			p.skipStatement()
+			directives = append(directives, d)
+		default:
+			// The first declaration ends the directive section.
+			return directives
+		}
+	}
+}
+
+// stringLiteral consumes adjacent string literals and returns their
+// concatenated value.
+func (p *dartParser) stringLiteral() string {
+	var value strings.Builder
+	for p.peek().kind == dartString {
+		value.WriteString(p.next().value)
+	}
+	return value.String()
+}
+
+// dottedName consumes `a.b.c` and returns it.
+func (p *dartParser) dottedName() string {
+	var parts []string
+	for p.peek().kind == dartIdent {
+		parts = append(parts, p.next().text)
+		if next := p.peek(); next.kind != dartPunct || next.text != "." {
+			break
+		}
+		p.next()
+	}
+	return strings.Join(parts, ".")
+}
+
+// parseClauses consumes the configurations and combinators of an import or
+// export through the terminating semicolon.
+func (p *dartParser) parseClauses(d *DartDirective) {
+	for {
+		tok := p.next()
+		switch {
+		case tok.kind == dartEOF:
+			return
+		case tok.kind == dartPunct && tok.text == ";":
+			return
+		case tok.kind == dartIdent && tok.text == "if":
+			d.Configurations = append(d.Configurations, p.configuration())
+		case tok.kind == dartIdent && tok.text == "deferred":
+			d.Deferred = true
+		case tok.kind == dartIdent && tok.text == "as":
+			if p.peek().kind == dartIdent {
+				d.Prefix = p.next().text
+			}
+		case tok.kind == dartIdent && tok.text == "show":
+			d.Show = append(d.Show, p.identifierList()...)
+		case tok.kind == dartIdent && tok.text == "hide":
+			d.Hide = append(d.Hide, p.identifierList()...)
+		}
+	}
+}
+
+// configuration consumes `(name [== 'value']) 'uri'` after `if`.
+func (p *dartParser) configuration() DartConfiguration {
+	var cfg DartConfiguration
+	if tok := p.peek(); tok.kind == dartPunct && tok.text == "(" {
+		p.next()
+	}
+	cfg.Test = p.dottedName()
+	if tok := p.peek(); tok.kind == dartPunct && tok.text == "==" {
+		p.next()
+		cfg.Value = p.stringLiteral()
+	}
+	if tok := p.peek(); tok.kind == dartPunct && tok.text == ")" {
+		p.next()
+	}
+	cfg.URI = p.stringLiteral()
+	return cfg
+}
+
+// identifierList consumes `a, b, c`.
+func (p *dartParser) identifierList() []string {
+	var names []string
+	for p.peek().kind == dartIdent {
+		names = append(names, p.next().text)
+		if next := p.peek(); next.kind != dartPunct || next.text != "," {
+			break
+		}
+		p.next()
+	}
+	return names
+}
+
+// skipMetadata consumes an annotation after `@`: a dotted name with optional
+// type and constructor arguments.
+func (p *dartParser) skipMetadata() {
+	p.dottedName()
+	if tok := p.peek(); tok.kind == dartPunct && tok.text == "<" {
+		p.skipBalanced("<", ">")
+	}
+	if tok := p.peek(); tok.kind == dartPunct && tok.text == "(" {
+		p.skipBalanced("(", ")")
+	}
+}
+
+// skipBalanced consumes a bracketed group starting at the next token.
+func (p *dartParser) skipBalanced(open, close string) {
+	depth := 0
+	for {
+		tok := p.next()
+		switch {
+		case tok.kind == dartEOF:
+			return
+		case tok.kind == dartPunct && tok.text == open:
+			depth++
+		case tok.kind == dartPunct && tok.text == close:
+			depth--
+			if depth == 0 {
+				return
+			}
+		}
+	}
+}
+
+// skipStatement consumes tokens through the next semicolon.
+func (p *dartParser) skipStatement() {
+	for {
+		tok := p.next()
+		if tok.kind == dartEOF || (tok.kind == dartPunct && tok.text == ";") {
+			return
+		}
+	}
+}
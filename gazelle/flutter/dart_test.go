@@ -0,0 +1,87 @@
+package flutter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDartDirectives(t *testing.T) {
+	src := `#!/usr/bin/env dart
+// import 'package:line_comment/x.dart';
+/* import 'package:block/x.dart';
+   /* nested */ import 'package:still_comment/x.dart';
+*/
+@TestOn('vm')
+library my.lib;
+
+import 'package:a/a.dart'
+    show A, B
+    hide C;
+import "package:b/b.dart" deferred as b;
+import 'src/stub.dart'
+    if (dart.library.io) 'package:io_impl/io.dart'
+    if (dart.library.html == 'true') 'package:web_impl/web.dart';
+export 'package:c/c.dart';
+import r'package:raw/raw.dart' as raw;
+part 'model.g.dart';
+
+const s = '''
+import 'package:in_string/x.dart';
+''';
+import 'package:after_declaration/x.dart';
+`
+
+	want := []DartDirective{
+		{Kind: DartImport, URI: "package:a/a.dart", Show: []string{"A", "B"}, Hide: []string{"C"}},
+		{Kind: DartImport, URI: "package:b/b.dart", Deferred: true, Prefix: "b"},
+		{
+			Kind: DartImport,
+			URI:  "src/stub.dart",
+			Configurations: []DartConfiguration{
+				{Test: "dart.library.io", URI: "package:io_impl/io.dart"},
+				{Test: "dart.library.html", Value: "true", URI: "package:web_impl/web.dart"},
+			},
+		},
+		{Kind: DartExport, URI: "package:c/c.dart"},
+		{Kind: DartImport, URI: "package:raw/raw.dart", Prefix: "raw"},
+		{Kind: DartPart, URI: "model.g.dart"},
+	}
+
+	got := ParseDartDirectives(src)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ParseDartDirectives:\nwant %+v\n got %+v", want, got)
+	}
+}
+
+func TestParseDartDirectivesPartOf(t *testing.T) {
+	for src, want := range map[string]DartDirective{
+		"part of 'model.dart';":       {Kind: DartPartOf, URI: "model.dart"},
+		"part of my.library;\n":       {Kind: DartPartOf, LibraryName: "my.library"},
+		"/* c */ part of \"a.dart\";": {Kind: DartPartOf, URI: "a.dart"},
+	} {
+		got := ParseDartDirectives(src)
+		if len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+			t.Errorf("ParseDartDirectives(%q): want [%+v] got %+v", src, want, got)
+		}
+	}
+}
+
+func TestParseDartDirectivesMetadataArguments(t *testing.T) {
+	src := `@Deprecated('use import "package:x/x.dart"; instead ${'}'}')
+import 'package:real/real.dart';
+`
+	got := ParseDartDirectives(src)
+	if len(got) != 1 || got[0].URI != "package:real/real.dart" {
+		t.Fatalf("ParseDartDirectives: want the single real import, got %+v", got)
+	}
+}
+
+func TestDartDirectiveURIs(t *testing.T) {
+	d := DartDirective{
+		URI:            "stub.dart",
+		Configurations: []DartConfiguration{{Test: "dart.library.io", URI: "io.dart"}},
+	}
+	if got := d.URIs(); !reflect.DeepEqual(got, []string{"stub.dart", "io.dart"}) {
+		t.Fatalf("URIs: got %v", got)
+	}
+}
@@ -0,0 +1,169 @@
+package flutter
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// canonicalRepoRegexp matches the canonical names Bazel gives repositories
+// created by rules_flutter's module extensions, in both the "~" (Bazel 7) and
+// "+" (Bazel 8) styles, capturing the extension and the repository name the
+// extension chose.
+var canonicalRepoRegexp = regexp.MustCompile(`^rules_flutter[~+][^~+]*[~+](flutter|pub)[~+]([^~+]+)$`)
+
+// obsoleteAttrs lists, by rule kind, the attributes rules_flutter no longer
+// accepts and what to do instead.
+var obsoleteAttrs = map[string]map[string]string{
+	"flutter_library": {"codegen": "port it to generator_commands or build_runner_modes"},
+	"dart_library":    {"codegen": "port it to generator_commands or build_runner_modes"},
+}
+
+// Fix rewrites outdated rules_flutter idioms in an existing BUILD file.
+// Canonical names of the SDK and pub repositories become the apparent names
+// the root module imports them under, and deps spelled both in long and
+// short form collapse into one. When run as "gazelle fix", attributes
+// rules_flutter removed and flutter_library and dart_library targets whose
+// pubspec is gone, other than the ones GenerateRules deletes itself, are
+// deleted; otherwise they are only reported.
+func (fl *flutterLang) Fix(c *config.Config, f *rule.File) {
+	fc := GetFlutterConfig(c)
+	for _, r := range f.Rules {
+		fixCanonicalLabels(r, fc)
+		if isLibraryKind(r.Kind()) {
+			dedupeDeps(r)
+		}
+	}
+	FixObsoleteAttrs(c, f, obsoleteAttrs)
+	removeStaleLibraries(c, f)
+}
+
+// fixCanonicalLabels replaces canonical rules_flutter extension repository
+// names in every string attribute of r.
+func fixCanonicalLabels(r *rule.Rule, fc *FlutterConfig) {
+	for _, key := range r.AttrKeys() {
+		bzl.Walk(r.Attr(key), func(x bzl.Expr, _ []bzl.Expr) {
+			if s, ok := x.(*bzl.StringExpr); ok {
+				s.Value = apparentLabel(s.Value, fc)
+			}
+		})
+	}
+}
+
+// apparentLabel rewrites a label in a repository created by a rules_flutter
+// extension, such as "@@rules_flutter++flutter+flutter_sdk//...", to use the
+// repository's apparent name. Other strings are returned unchanged.
+func apparentLabel(s string, fc *FlutterConfig) string {
+	if !strings.HasPrefix(s, "@@") {
+		return s
+	}
+	repo, rest := s[len("@@"):], ""
+	if i := strings.Index(repo, "//"); i >= 0 {
+		repo, rest = repo[:i], repo[i:]
+	}
+	m := canonicalRepoRegexp.FindStringSubmatch(repo)
+	if m == nil {
+		return s
+	}
+
+	ext, name := m[1], m[2]
+	apparent := name
+	if ext == "pub" {
+		apparent = fc.pubRepos.apparentName(name)
+	} else if a, ok := fc.flutterRepos[name]; ok {
+		apparent = a
+	}
+	if rest == "" {
+		// "@@repo" is short for "@@repo//:repo".
+		rest = "//:" + name
+	}
+	return canonicalLabel("@" + apparent + rest)
+}
+
+// dedupeDeps rewrites the deps of r in canonical short form and drops labels
+// listed more than once, keeping the comments of the dropped entries.
+func dedupeDeps(r *rule.Rule) {
+	list, ok := r.Attr("deps").(*bzl.ListExpr)
+	if !ok {
+		return
+	}
+	seen := make(map[string]*bzl.StringExpr)
+	kept := list.List[:0]
+	for _, x := range list.List {
+		s, ok := x.(*bzl.StringExpr)
+		if !ok {
+			kept = append(kept, x)
+			continue
+		}
+		s.Value = canonicalLabel(s.Value)
+		if first, ok := seen[s.Value]; ok {
+			first.Comments.Before = append(first.Comments.Before, s.Comments.Before...)
+			first.Comments.Suffix = append(first.Comments.Suffix, s.Comments.Suffix...)
+			continue
+		}
+		seen[s.Value] = s
+		kept = append(kept, s)
+	}
+	list.List = kept
+}
+
+// FixObsoleteAttrs deletes the attributes in obsolete, keyed by rule kind and
+// then attribute name with a hint on what replaces them, from the rules in f
+// when running "gazelle fix", and reports them otherwise.
+func FixObsoleteAttrs(c *config.Config, f *rule.File, obsolete map[string]map[string]string) {
+	for _, r := range f.Rules {
+		attrs := obsolete[r.Kind()]
+		for _, key := range r.AttrKeys() {
+			hint, ok := attrs[key]
+			if !ok {
+				continue
+			}
+			if !c.ShouldFix {
+				log.Printf("%s: %s %q sets %s, which rules_flutter no longer supports; %s, or run gazelle fix to remove it", f.Path, r.Kind(), r.Name(), key, hint)
+				continue
+			}
+			log.Printf("%s: removed %s = %s from %s %q; %s", f.Path, key, bzl.FormatString(r.Attr(key)), r.Kind(), r.Name(), hint)
+			r.DelAttr(key)
+		}
+	}
+}
+
+// removeStaleLibraries deletes library targets whose pubspec file no
+// longer exists when running "gazelle fix", and reports them otherwise.
+// Targets marked "# keep", pubspecs given as labels and the libraries
+// GenerateRules already deletes through emptyRules are left alone.
+func removeStaleLibraries(c *config.Config, f *rule.File) {
+	if f.Path == "" {
+		return
+	}
+	fc := GetFlutterConfig(c)
+	managed := fc.Generate && !fc.IsExcluded(f.Pkg)
+	dir := filepath.Dir(f.Path)
+	for _, r := range f.Rules {
+		if !isLibraryKind(r.Kind()) || r.ShouldKeep() {
+			continue
+		}
+		if managed && (r.Name() == fc.LibraryName || r.Name() == devLibraryName(fc)) {
+			continue
+		}
+		pubspec := r.AttrString("pubspec")
+		if pubspec == "" || strings.ContainsAny(pubspec[:1], ":/@") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(pubspec))); !os.IsNotExist(err) {
+			continue
+		}
+		if !c.ShouldFix {
+			log.Printf("%s: the pubspec %s of %s %q no longer exists; run gazelle fix to remove the target", f.Path, pubspec, r.Kind(), r.Name())
+			continue
+		}
+		log.Printf("%s: removed %s %q; its pubspec %s no longer exists", f.Path, r.Kind(), r.Name(), pubspec)
+		r.Delete()
+	}
+}
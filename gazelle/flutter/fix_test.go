@@ -0,0 +1,182 @@
+package flutter
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// fixFile loads content as dir/BUILD.bazel, runs Fix over it and returns the
+// formatted result.
+func fixFile(t *testing.T, c *config.Config, dir, content string) string {
+	t.Helper()
+	f, err := rule.LoadData(filepath.Join(dir, "BUILD.bazel"), "", []byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	(&flutterLang{}).Fix(c, f)
+	return string(f.Format())
+}
+
+func fixTestConfig(fc *FlutterConfig, shouldFix bool) *config.Config {
+	return &config.Config{ShouldFix: shouldFix, Exts: map[string]interface{}{"flutter": fc}}
+}
+
+func TestFixRewritesCanonicalRepositoryNames(t *testing.T) {
+	fc := &FlutterConfig{SDKRepo: "@my_sdk", flutterRepos: map[string]string{"flutter_sdk": "my_sdk"}}
+	dir := writePackage(t, map[string]string{"pubspec.yaml": "name: app\n"})
+
+	got := fixFile(t, fixTestConfig(fc, false), dir, `
+flutter_library(
+    name = "lib",
+    pubspec = "pubspec.yaml",
+    deps = [
+        "@@rules_flutter++flutter+flutter_sdk//flutter/packages/flutter:flutter",
+        "@@rules_flutter~~pub~pub_http//:http",
+        "@@rules_flutter~0.2.0~pub~pub_meta",
+        "@@other_module+//tools:lint",
+    ],
+)
+`)
+	for _, want := range []string{
+		`"@my_sdk//flutter/packages/flutter"`,
+		`"@pub_http//:http"`,
+		`"@pub_meta"`,
+		`"@@other_module+//tools:lint"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("fixed file lacks %s:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "@@rules_flutter") {
+		t.Errorf("canonical rules_flutter label left behind:\n%s", got)
+	}
+}
+
+func TestFixCollapsesLongAndShortDeps(t *testing.T) {
+	fc := &FlutterConfig{SDKRepo: "@flutter_sdk"}
+	dir := writePackage(t, map[string]string{"pubspec.yaml": "name: app\n"})
+
+	got := fixFile(t, fixTestConfig(fc, false), dir, `
+flutter_library(
+    name = "lib",
+    pubspec = "pubspec.yaml",
+    deps = [
+        "@flutter_sdk//flutter/packages/flutter",
+        "@flutter_sdk//flutter/packages/flutter:flutter",  # keep
+        "@@rules_flutter++flutter+flutter_sdk//flutter/packages/flutter:flutter",
+        "@pub_http//:http",
+    ],
+)
+`)
+	want := `flutter_library(
+    name = "lib",
+    pubspec = "pubspec.yaml",
+    deps = [
+        "@flutter_sdk//flutter/packages/flutter",  # keep
+        "@pub_http//:http",
+    ],
+)
+`
+	if got != want {
+		t.Fatalf("fixed file:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFixRemovesObsoleteAttrsOnlyWhenFixing(t *testing.T) {
+	fc := &FlutterConfig{SDKRepo: "@flutter_sdk"}
+	dir := writePackage(t, map[string]string{"pubspec.yaml": "name: app\n"})
+	content := `
+flutter_library(
+    name = "lib",
+    codegen = ["build_runner"],
+    pubspec = "pubspec.yaml",
+)
+`
+	if got := fixFile(t, fixTestConfig(fc, false), dir, content); !strings.Contains(got, "codegen") {
+		t.Fatalf("codegen removed outside gazelle fix:\n%s", got)
+	}
+	if got := fixFile(t, fixTestConfig(fc, true), dir, content); strings.Contains(got, "codegen") {
+		t.Fatalf("codegen not removed by gazelle fix:\n%s", got)
+	}
+}
+
+func TestFixRemovesLibrariesWithoutPubspec(t *testing.T) {
+	fc := &FlutterConfig{SDKRepo: "@flutter_sdk"}
+	dir := writePackage(t, map[string]string{"pubspec.yaml": "name: app\n"})
+	if err := os.Remove(filepath.Join(dir, "pubspec.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	content := `
+flutter_library(
+    name = "lib",
+    pubspec = "pubspec.yaml",
+)
+
+flutter_library(
+    name = "kept",
+    pubspec = "pubspec.yaml",
+)  # keep
+
+flutter_library(
+    name = "generated",
+    pubspec = ":pubspec_gen",
+)
+
+dart_library(
+    name = "utils",
+    pubspec = "pubspec.yaml",
+)
+`
+	if got := fixFile(t, fixTestConfig(fc, false), dir, content); !strings.Contains(got, `name = "lib"`) {
+		t.Fatalf("stale library removed outside gazelle fix:\n%s", got)
+	}
+	got := fixFile(t, fixTestConfig(fc, true), dir, content)
+	for _, name := range []string{"lib", "utils"} {
+		if strings.Contains(got, `name = "`+name+`"`) {
+			t.Errorf("stale library %s not removed:\n%s", name, got)
+		}
+	}
+	for _, name := range []string{"kept", "generated"} {
+		if !strings.Contains(got, `name = "`+name+`"`) {
+			t.Errorf("%s was removed:\n%s", name, got)
+		}
+	}
+}
+
+func TestFixLeavesGeneratedLibrariesToGenerateRules(t *testing.T) {
+	fc := &FlutterConfig{SDKRepo: "@flutter_sdk", LibraryName: "lib", Generate: true}
+	dir := t.TempDir()
+	content := `
+flutter_library(
+    name = "lib",
+    pubspec = "pubspec.yaml",
+)
+
+dart_library(
+    name = "utils",
+    pubspec = "pubspec.yaml",
+)
+`
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	fixFile(t, fixTestConfig(fc, false), dir, content)
+	if strings.Contains(logs.String(), `"lib"`) {
+		t.Errorf("reported a library emptyRules deletes:\n%s", logs.String())
+	}
+
+	got := fixFile(t, fixTestConfig(fc, true), dir, content)
+	if !strings.Contains(got, `name = "lib"`) {
+		t.Errorf("Fix removed a library emptyRules deletes:\n%s", got)
+	}
+	if strings.Contains(got, `name = "utils"`) {
+		t.Errorf("stale library utils not removed:\n%s", got)
+	}
+}
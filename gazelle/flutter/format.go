@@ -0,0 +1,71 @@
+package flutter
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// formatCheckDirs are the package directories whose Dart sources the
+// generated dart_format_test checks.
+var formatCheckDirs = []string{"lib", "test", "bin", "tool"}
+
+// protocPluginSuffixes are the extensions of the files protoc_plugin
+// generates for a .proto file.
+var protocPluginSuffixes = []string{".pb.dart", ".pbenum.dart", ".pbgrpc.dart", ".pbjson.dart", ".pbserver.dart"}
+
+// generateFormatRule returns a dart_format_test over the package's Dart
+// sources in formatCheckDirs, leaving out generated files, including the
+// checked-in output of l10n when the package generates localizations, and
+// subpackages, or nil when flutter_format_check is off or there is nothing to
+// check.
+func generateFormatRule(args language.GenerateArgs, fc *FlutterConfig, l10n *localizations) *rule.Rule {
+	if !fc.FormatCheck {
+		return nil
+	}
+	buildFileNames := args.Config.ValidBuildFileNames
+	var srcs []string
+	for _, dir := range formatCheckDirs {
+		if !containsString(args.Subdirs, dir) || fc.IsExcluded(path.Join(args.Rel, dir)) {
+			continue
+		}
+		for _, f := range walkPackageDir(filepath.Join(args.Dir, dir), args.Dir, buildFileNames, fc, args.Rel) {
+			if strings.HasSuffix(f, ".dart") && !isGeneratedDart(f) {
+				srcs = append(srcs, f)
+			}
+		}
+	}
+	if l10n != nil {
+		srcs = l10n.withoutGenerated(srcs)
+	}
+	if len(srcs) == 0 {
+		return nil
+	}
+	sort.Strings(srcs)
+
+	r := rule.NewRule("dart_format_test", formatRuleName(fc))
+	r.SetAttr("srcs", srcsValue{files: srcs, dirs: formatCheckDirs})
+	return r
+}
+
+// isGeneratedDart reports whether the Dart file is generated, by
+// build_runner or protoc_plugin, whose output dart format may disagree with.
+func isGeneratedDart(name string) bool {
+	for _, suffixes := range [][]string{generatedPartSuffixes, protocPluginSuffixes} {
+		for _, suffix := range suffixes {
+			if strings.HasSuffix(name, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// formatRuleName returns the name of the generated dart_format_test.
+func formatRuleName(fc *FlutterConfig) string {
+	return fc.LibraryName + "_format"
+}
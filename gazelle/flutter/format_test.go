@@ -0,0 +1,219 @@
+package flutter
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/merger"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+func TestIsGeneratedDart(t *testing.T) {
+	for name, want := range map[string]bool{
+		"lib/model.g.dart":          true,
+		"lib/model.freezed.dart":    true,
+		"lib/src/api.pb.dart":       true,
+		"lib/src/api.pbgrpc.dart":   true,
+		"lib/main.dart":             false,
+		"lib/pb.dart":               false,
+		"test/model_g_test.dart":    false,
+		"tool/freezed_helpers.dart": false,
+	} {
+		if got := isGeneratedDart(name); got != want {
+			t.Errorf("isGeneratedDart(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestGenerateRulesAddsFormatTest(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":            "name: example\nenvironment:\n  sdk: \">=3.0.0 <4.0.0\"\n",
+		"lib/example.dart":        "part 'example.g.dart';\n",
+		"lib/example.g.dart":      "part of 'example.dart';\n",
+		"lib/src/api.pb.dart":     "",
+		"lib/src/api.pbenum.dart": "",
+		"lib/src/model.dart":      "",
+		"lib/README.md":           "",
+		"test/example_test.dart":  "void main() {}\n",
+		"bin/example.dart":        "void main() {}\n",
+		"tool/release.dart":       "void main() {}\n",
+		"example/main.dart":       "void main() {}\n",
+	})
+
+	args := generateArgs(t, dir, "example")
+	result := (&flutterLang{}).GenerateRules(args)
+	if findRule(result.Gen, "dart_format_test", "lib_format") != nil {
+		t.Fatalf("dart_format_test generated without %s", DirectiveFormatCheck)
+	}
+
+	args = generateArgs(t, dir, "example")
+	GetFlutterConfig(args.Config).FormatCheck = true
+	result = (&flutterLang{}).GenerateRules(args)
+	r := findRule(result.Gen, "dart_format_test", "lib_format")
+	if r == nil {
+		t.Fatal("no dart_format_test generated")
+	}
+	want := []string{
+		"bin/example.dart",
+		"lib/example.dart",
+		"lib/src/model.dart",
+		"test/example_test.dart",
+		"tool/release.dart",
+	}
+	if got := r.AttrStrings("srcs"); !reflect.DeepEqual(got, want) {
+		t.Errorf("srcs: want %v, got %v", want, got)
+	}
+	if len(result.Imports) != len(result.Gen) {
+		t.Errorf("%d imports for %d rules", len(result.Imports), len(result.Gen))
+	}
+}
+
+func TestGenerateRulesFormatTestSkipsLocalizationsOutput(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":                       "name: example\nenvironment:\n  flutter: \">=3.0.0\"\n",
+		"l10n.yaml":                          "synthetic-package: false\n",
+		"lib/main.dart":                      "void main() {}\n",
+		"lib/l10n/app_en.arb":                "{}",
+		"lib/l10n/app_localizations.dart":    "",
+		"lib/l10n/app_localizations_en.dart": "",
+	})
+	args := generateArgs(t, dir, "example")
+	GetFlutterConfig(args.Config).FormatCheck = true
+
+	r := findRule((&flutterLang{}).GenerateRules(args).Gen, "dart_format_test", "lib_format")
+	if r == nil {
+		t.Fatal("no dart_format_test generated")
+	}
+	if got, want := r.AttrStrings("srcs"), []string{"lib/main.dart"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("srcs: want %v got %v", want, got)
+	}
+}
+
+func TestGenerateRulesFormatTestHonorsExcludes(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":         "name: example\nenvironment:\n  sdk: \">=3.0.0 <4.0.0\"\n",
+		"lib/example.dart":     "",
+		"tool/release.dart":    "",
+		"test/fixtures/x.dart": "",
+	})
+	args := generateArgs(t, dir, "example")
+	fc := GetFlutterConfig(args.Config)
+	fc.FormatCheck = true
+	fc.Exclude = []ExcludePattern{{Dir: "example", Pattern: "tool"}, {Dir: "example", Pattern: "test/fixtures/**"}}
+
+	r := findRule((&flutterLang{}).GenerateRules(args).Gen, "dart_format_test", "lib_format")
+	if r == nil {
+		t.Fatal("no dart_format_test generated")
+	}
+	if got, want := r.AttrStrings("srcs"), []string{"lib/example.dart"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("srcs: want %v, got %v", want, got)
+	}
+}
+
+func TestGenerateRulesMergesFormatTest(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":  "name: app\nenvironment:\n  sdk: \">=3.0.0 <4.0.0\"\n",
+		"lib/main.dart": "void main() {}\n",
+	})
+	const formatTest = `
+dart_library(
+    name = "lib",
+    srcs = ["lib/main.dart"],
+    pubspec = "pubspec.yaml",
+)
+
+dart_format_test(
+    name = "lib_format",
+    srcs = glob(["lib/**/*.dart"]),
+)
+`
+
+	// Without the directive, hand-written format tests are left alone.
+	args := generateArgs(t, dir, "app")
+	if got, want := mergeGenerated(t, args, formatTest), []string{"dart_format_test lib_format", "dart_library lib"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	// With it, the generated srcs keep a hand-written glob.
+	args = generateArgs(t, dir, "app")
+	GetFlutterConfig(args.Config).FormatCheck = true
+	f, err := rule.LoadData(filepath.Join(dir, "BUILD.bazel"), "app", []byte(formatTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args.File = f
+	fl := &flutterLang{}
+	res := fl.GenerateRules(args)
+	merger.MergeFile(f, res.Empty, res.Gen, merger.PreResolve, fl.Kinds())
+	r := findRule(f.Rules, "dart_format_test", "lib_format")
+	if r == nil {
+		t.Fatal("dart_format_test deleted")
+	}
+	if got := bzl.FormatString(r.Attr("srcs")); !strings.Contains(got, "glob(") {
+		t.Errorf("srcs glob replaced: %s", got)
+	}
+}
+
+func TestGenerateRulesDeletesFormatTestWithoutSources(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml": "name: app\nenvironment:\n  sdk: \">=3.0.0 <4.0.0\"\n",
+	})
+	args := generateArgs(t, dir, "app")
+	GetFlutterConfig(args.Config).FormatCheck = true
+
+	got := mergeGenerated(t, args, `
+dart_format_test(
+    name = "lib_format",
+    srcs = ["lib/main.dart"],
+)
+`)
+	if want := []string{"dart_library lib"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
+
+func TestGenerateRulesFormatTestStopsAtSubpackages(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":              "name: example\nenvironment:\n  sdk: \">=3.0.0 <4.0.0\"\n",
+		"lib/example.dart":          "",
+		"lib/src/vendored/BUILD":    "",
+		"lib/src/vendored/x.dart":   "",
+		"test/example_test.dart":    "",
+		"test/fixture/pubspec.yaml": "name: fixture\n",
+		"test/fixture/lib/f.dart":   "",
+		"tool/BUILD.bazel":          "",
+		"tool/gen.dart":             "",
+	})
+	args := generateArgs(t, dir, "example")
+	GetFlutterConfig(args.Config).FormatCheck = true
+
+	r := findRule((&flutterLang{}).GenerateRules(args).Gen, "dart_format_test", "lib_format")
+	if r == nil {
+		t.Fatal("no dart_format_test generated")
+	}
+	if got, want := r.AttrStrings("srcs"), []string{"lib/example.dart", "test/example_test.dart"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("srcs: want %v, got %v", want, got)
+	}
+}
+
+func TestGenerateRulesLeavesFormatTestWhenTurnedOff(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":  "name: app\nenvironment:\n  sdk: \">=3.0.0 <4.0.0\"\n",
+		"lib/main.dart": "void main() {}\n",
+	})
+
+	// Unlike lib_analyze, a lib_format generated before the directive was
+	// turned off stays until it is deleted by hand.
+	got := mergeGenerated(t, generateArgs(t, dir, "app"), `
+dart_format_test(
+    name = "lib_format",
+    srcs = ["lib/main.dart"],
+)
+`)
+	if want := []string{"dart_format_test lib_format", "dart_library lib"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
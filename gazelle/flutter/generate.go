@@ -2,7 +2,8 @@ package flutter
 
 import (
 	"fmt"
-	"os"
+	"log"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -13,15 +14,21 @@ import (
 	"github.com/bazelbuild/bazel-gazelle/repo"
 	"github.com/bazelbuild/bazel-gazelle/resolve"
 	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
 )
 
 // GenerateRules generates Flutter build rules for a directory
 func (fl *flutterLang) GenerateRules(args language.GenerateArgs) language.GenerateResult {
 	fc := GetFlutterConfig(args.Config)
 
-	if !fc.Generate || fc.IsExcluded(args.Rel) {
+	if fc.IsExcluded(args.Rel) {
 		return language.GenerateResult{}
 	}
+	if !fc.Generate {
+		// Targets looking like ones Gazelle generated go; see emptyRules
+		// for what stays.
+		return language.GenerateResult{Empty: emptyRules(args.File, fc, nil)}
+	}
 
 	hasPubspec := false
 	for _, f := range args.RegularFiles {
@@ -32,17 +39,20 @@ func (fl *flutterLang) GenerateRules(args language.GenerateArgs) language.Genera
 	}
 
 	if !hasPubspec {
-		return language.GenerateResult{}
+		return language.GenerateResult{Empty: emptyRules(args.File, fc, nil)}
 	}
 
-	hasPubDeps := false
 	var pubDeps *PubDeps
 	for _, f := range args.RegularFiles {
 		if f == "pub_deps.json" {
-			hasPubDeps = true
 			depsPath := filepath.Join(args.Dir, f)
 			deps, err := ParsePubDeps(depsPath)
-			if err == nil {
+			switch {
+			case err != nil:
+				log.Printf("%s: ignoring unreadable pub_deps.json, falling back to pubspec.yaml: %v", depsPath, err)
+			case len(GetDirectDependencies(deps)) == 0:
+				log.Printf("%s: no direct dependencies found, falling back to pubspec.yaml", depsPath)
+			default:
 				pubDeps = deps
 			}
 			break
@@ -75,104 +85,462 @@ func (fl *flutterLang) GenerateRules(args language.GenerateArgs) language.Genera
 
 	r := rule.NewRule(ruleKind, fc.LibraryName)
 	r.SetAttr("pubspec", "pubspec.yaml")
-	if hasPubDeps {
+	if pubDeps != nil {
+		// An unusable pub_deps.json would only fail the library action.
 		r.SetAttr("pub_deps", "pub_deps.json")
 	}
 
+	if pubDeps == nil {
+		// Packages that haven't run `flutter pub deps` yet still declare
+		// their direct dependencies in pubspec.yaml.
+		pubDeps = PubDepsFromPubspec(pubspecYaml)
+	}
+
+	var sources sourceFiles
+	if hasLib {
+		sources = collectSourceFiles(args.Dir, args.Config.ValidBuildFileNames, fc, args.Rel)
+	}
+
+	// build_runner regenerates its parts inside the library action, so
+	// checked-in copies stay out of srcs. The action needs build_runner and
+	// the generators, dev dependencies that join the library's deps; the
+	// rest stay on lib_dev.
+	codegen := detectBuildRunner(args.Dir, args.RegularFiles, sources.Dart, pubDeps)
+	inAction := codegen.runsInAction(existingRule(args.File, ruleKind, fc.LibraryName))
+	var generatedExcludes []string
+	if inAction {
+		r.SetAttr("build_runner_modes", []string{"build"})
+		sources.Dart = codegen.withoutParts(sources.Dart)
+		generatedExcludes = codegen.partExcludes()
+	}
+	mergeDevDeps := fc.DevDeps == DevDepsMerge
+
+	// flutter gen-l10n runs in the library action too: the ARB files move
+	// from srcs to data, and its checked-in output is left out.
+	var dataFiles []string
+	l10n := detectLocalizations(args.Dir, args.RegularFiles, pubspecYaml, args.Rel)
+	genL10n := generatorCommandsValue{genL10n: l10n != nil}
+	setOwnedAttr(r, "generator_commands", genL10n, genL10n.genL10n, args.File)
+	if l10n != nil {
+		sources.Dart = l10n.withoutGenerated(sources.Dart)
+		sources.Assets = l10n.withoutGenerated(sources.Assets)
+		generatedExcludes = append(generatedExcludes, l10n.Excludes...)
+		dataFiles = l10n.Inputs
+	}
+
+	var srcs srcsValue
 	if hasLib {
-		srcs := collectSourceFiles(args.Dir, hasLib)
-		if len(srcs) > 0 {
+		srcs = librarySrcs(sources.All(), generatedExcludes, fc, args.Rel)
+		if len(srcs.files) > 0 {
 			r.SetAttr("srcs", srcs)
 		}
 	}
 
-	if hasPubDeps && pubDeps != nil {
-		deps := generateDeps(pubDeps, fc, args.Rel)
+	data := dataValue{
+		files: unionSorted(pubspecDataFiles(args.Dir, pubspecYaml, fc, args.Rel), dataFiles),
+		owned: pubspecDataOwner(args.Dir, pubspecYaml, args.File),
+	}
+	setOwnedAttr(r, "data", data, len(data.files) > 0, args.File)
+
+	libImports := resolveInputs{}
+	if pubspecYaml != nil && pubspecYaml.Name != "" {
+		r.SetPrivateAttr(pubspecNameKey, pubspecYaml.Name)
+		libImports.PackageName = pubspecYaml.Name
+	}
+	libImports.HostedURLs = hostedURLs(pubDeps, fc, args.Rel)
+	libImports.SDKDeps = sdkDeps(pubDeps)
+	libImports.GitDeps = gitDeps(pubDeps)
+
+	// Path dependencies are looked up by pubspec name in Resolve, once every
+	// library in the repository has been indexed.
+	pathDeps, devPathDeps := pathDependencies(pubDeps, fc, args.Rel)
+	allPathDeps := mergePathDeps(pathDeps, devPathDeps)
+	if fc.DepsMode == DepsModeImports || mergeDevDeps {
+		pathDeps, devPathDeps = allPathDeps, nil
+	}
+	libImports.PathDeps = pathDeps
+
+	var devDeps []string
+	if fc.DepsMode == DepsModeImports {
+		// Deps are resolved from the sources' package: imports in Resolve.
+		libImports.Packages = importedPackages(args.Dir, sources.Dart)
+		if inAction {
+			libImports.Packages = unionSorted(libImports.Packages, codegen.Generators)
+		}
+		if l10n != nil {
+			libImports.Packages = unionSorted(libImports.Packages, []string{localizationsPackage})
+		}
+	} else if pubDeps != nil {
+		var deps []string
+		deps, devDeps = generateDeps(pubDeps, fc, args.Rel)
+		if mergeDevDeps {
+			deps = mergeLabels(deps, devDeps)
+			devDeps = nil
+		} else if inAction {
+			var generators []string
+			generators, devDeps = codegen.generatorLabels(pubDeps, devDeps, fc, args.Rel)
+			deps = mergeLabels(deps, generators)
+		}
+		if l10n != nil {
+			if dep, _ := sdkDependencyLabel(localizationsPackage, fc); dep != "" {
+				deps = mergeLabels(deps, []string{dep})
+			}
+		}
 		if len(deps) > 0 {
 			r.SetAttr("deps", deps)
 		}
 	}
 
-	// Must return same number of imports as rules (1)
-	imports := []interface{}{[]resolve.ImportSpec{}}
+	// Must return same number of imports as rules
+	gen := []*rule.Rule{r}
+	imports := []interface{}{libImports}
+
+	// Tests and analysis run against lib_dev when the package has dev
+	// dependencies: test frameworks, mocks and lint rule packages.
+	t := generateTestRule(args, fc)
+	analyze, analysisOptions := generateAnalyzeRule(args, fc, t)
+	if t != nil || analyze != nil {
+		devImports := libImports
+		devImports.PathDeps = allPathDeps
+		needDev := len(devDeps) > 0 || len(devPathDeps) > 0
+		if fc.DepsMode == DepsModeImports {
+			var devPackages []string
+			if t != nil {
+				devPackages = importedPackages(args.Dir, t.AttrStrings("srcs"))
+			}
+			if analysisOptions != nil {
+				if pkg := analysisOptions.IncludedPackage(); pkg != "" {
+					devPackages = append(devPackages, pkg)
+				}
+			}
+			devImports.Packages = unionSorted(libImports.Packages, devPackages)
+			if mergeDevDeps {
+				imports[0] = devImports
+			} else {
+				needDev = len(devImports.Packages) > len(libImports.Packages)
+			}
+		}
+
+		embed := []string{localLabel(fc.LibraryName)}
+		if needDev {
+			dev := generateDevLibrary(r, srcs, data, genL10n, devDeps, fc, args.File)
+			embed = []string{localLabel(dev.Name())}
+			gen = append(gen, dev)
+			imports = append(imports, devImports)
+		}
+		for _, test := range []*rule.Rule{t, analyze} {
+			if test != nil {
+				test.SetAttr("embed", embed)
+				gen = append(gen, test)
+				imports = append(imports, resolveInputs{})
+			}
+		}
+	}
+
+	if format := generateFormatRule(args, fc, l10n); format != nil {
+		gen = append(gen, format)
+		imports = append(imports, resolveInputs{})
+	}
+
+	if ruleKind == "flutter_library" {
+		if app := generateAppRule(args, fc); app != nil {
+			gen = append(gen, app)
+			imports = append(imports, resolveInputs{})
+		}
+	}
 
 	return language.GenerateResult{
-		Gen:     []*rule.Rule{r},
+		Gen:     gen,
+		Empty:   emptyRules(args.File, fc, gen),
 		Imports: imports,
 	}
 }
 
-// collectSourceFiles walks the lib/ directory and returns all source files
-func collectSourceFiles(baseDir string, hasLib bool) []string {
-	var srcs []string
+// emptyRules returns empty rules for the targets in f that GenerateRules
+// would name but didn't generate this time, so Gazelle deletes them once
+// their inputs are gone: the package library and its testonly copy, of either
+// library kind, the package test, its app, its analyze test once the library
+// goes too and, with flutter_format_check on, its format test. Rules that
+// don't look generated, such as libraries without a pubspec or tests and
+// apps embedding something else, are left alone.
+func emptyRules(f *rule.File, fc *FlutterConfig, gen []*rule.Rule) []*rule.Rule {
+	if f == nil {
+		return nil
+	}
+	generated := make(map[string]bool, len(gen))
+	for _, r := range gen {
+		generated[r.Kind()+" "+r.Name()] = true
+	}
+	libraries := map[string]bool{fc.LibraryName: true, devLibraryName(fc): true}
+	libraryGone := !generated["flutter_library "+fc.LibraryName] && !generated["dart_library "+fc.LibraryName]
 
-	if hasLib {
-		libFiles := walkDir(filepath.Join(baseDir, "lib"), baseDir)
-		srcs = append(srcs, libFiles...)
+	var empty []*rule.Rule
+	for _, r := range f.Rules {
+		if generated[r.Kind()+" "+r.Name()] {
+			continue
+		}
+		switch r.Kind() {
+		case "flutter_library", "dart_library":
+			if !libraries[r.Name()] || r.AttrString("pubspec") == "" {
+				continue
+			}
+		case "flutter_test":
+			if r.Name() != testRuleName(fc) || !embedsAny(r, libraries) {
+				continue
+			}
+		case "flutter_analyze_test":
+			// Packages without their own analysis_options.yaml still
+			// analyze with the defaults or a parent's options, so an analyze
+			// test only goes with its library.
+			if !libraryGone || r.Name() != analyzeRuleName(fc) || !embedsAny(r, libraries) {
+				continue
+			}
+		case "flutter_app":
+			// An app left behind by its library, or by the last platform
+			// directory, would no longer build.
+			if r.Name() != appRuleName || !embedsAny(r, libraries) {
+				continue
+			}
+		case "dart_format_test":
+			// Hand-written format tests are common and the directive is off
+			// by default, so only packages opted into flutter_format_check
+			// have theirs managed; turning it off leaves lib_format alone.
+			if !fc.FormatCheck || r.Name() != formatRuleName(fc) {
+				continue
+			}
+		default:
+			continue
+		}
+		empty = append(empty, rule.NewRule(r.Kind(), r.Name()))
 	}
+	return empty
+}
 
-	// Sort for consistent output
-	sort.Strings(srcs)
-	return srcs
+// embedsAny reports whether r embeds one of the named targets in its own
+// package.
+func embedsAny(r *rule.Rule, names map[string]bool) bool {
+	for _, embed := range r.AttrStrings("embed") {
+		if l, err := label.Parse(embed); err == nil && l.Relative && names[l.Name] {
+			return true
+		}
+	}
+	return false
 }
 
-// walkDir recursively walks a directory and returns relative paths to all files
-func walkDir(dir string, baseDir string) []string {
-	var files []string
+// generateTestRule returns a flutter_test embedding the package library when
+// the package has a test/ directory or *_test.dart files next to pubspec.yaml.
+// It returns nil when no test sources are found.
+func generateTestRule(args language.GenerateArgs, fc *FlutterConfig) *rule.Rule {
+	hasTestDir := false
+	for _, d := range args.Subdirs {
+		if d == "test" {
+			hasTestDir = true
+			break
+		}
+	}
 
-	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // Skip errors
+	var rootTests []string
+	for _, f := range args.RegularFiles {
+		if strings.HasSuffix(f, "_test.dart") && !fc.IsExcluded(path.Join(args.Rel, f)) {
+			rootTests = append(rootTests, f)
 		}
-		if !info.IsDir() {
-			// Get relative path from baseDir
-			relPath, err := filepath.Rel(baseDir, path)
-			if err == nil {
-				files = append(files, relPath)
-			}
+	}
+	sort.Strings(rootTests)
+
+	var srcs []string
+	if hasTestDir && !fc.IsExcluded(path.Join(args.Rel, "test")) {
+		srcs = append(srcs, walkPackageDir(filepath.Join(args.Dir, "test"), args.Dir, args.Config.ValidBuildFileNames, fc, args.Rel)...)
+	}
+	srcs = append(srcs, rootTests...)
+
+	hasTests := false
+	for _, src := range srcs {
+		if strings.HasSuffix(src, "_test.dart") {
+			hasTests = true
+			break
 		}
+	}
+	if !hasTests {
 		return nil
-	})
+	}
+	sort.Strings(srcs)
 
-	return files
+	r := rule.NewRule("flutter_test", testRuleName(fc))
+	r.SetAttr("srcs", srcs)
+	r.SetAttr("embed", []string{localLabel(fc.LibraryName)})
+
+	// flutter_test runs test/ by default; tests living next to pubspec.yaml
+	// must be listed explicitly.
+	if len(rootTests) > 0 {
+		var testFiles []string
+		if hasTestDir {
+			testFiles = append(testFiles, "test/")
+		}
+		testFiles = append(testFiles, rootTests...)
+		r.SetAttr("test_files", testFiles)
+	}
+
+	return r
+}
+
+// generateDevLibrary returns a testonly copy of the package library that
+// additionally depends on the package's dev dependencies. Test targets embed
+// it so the production library never carries test frameworks. f is the
+// existing BUILD file, if any.
+func generateDevLibrary(lib *rule.Rule, srcs srcsValue, data dataValue, genL10n generatorCommandsValue, devDeps []string, fc *FlutterConfig, f *rule.File) *rule.Rule {
+	r := rule.NewRule(lib.Kind(), devLibraryName(fc))
+	if len(srcs.files) > 0 {
+		r.SetAttr("srcs", srcs)
+	}
+	setOwnedAttr(r, "data", data, len(data.files) > 0, f)
+	setOwnedAttr(r, "generator_commands", genL10n, genL10n.genL10n, f)
+	for _, attr := range []string{"pubspec", "pub_deps"} {
+		if value := lib.AttrString(attr); value != "" {
+			r.SetAttr(attr, value)
+		}
+	}
+	if modes := lib.AttrStrings("build_runner_modes"); len(modes) > 0 {
+		r.SetAttr("build_runner_modes", modes)
+	}
+	if deps := mergeLabels(lib.AttrStrings("deps"), devDeps); len(deps) > 0 {
+		r.SetAttr("deps", deps)
+	}
+	r.SetAttr("testonly", true)
+	r.SetPrivateAttr(devLibraryKey, true)
+	return r
 }
 
-// generateDeps creates a list of dependency labels from pub_deps.json
-func generateDeps(depsFile *PubDeps, fc *FlutterConfig, rel string) []string {
+// isDevLibrary reports whether r is a testonly library, generated in this run
+// or loaded from a BUILD file. Those share the pubspec name of the production
+// library, which is the one other packages must resolve to.
+func isDevLibrary(r *rule.Rule, fc *FlutterConfig) bool {
+	if dev, _ := r.PrivateAttr(devLibraryKey).(bool); dev {
+		return true
+	}
+	if r.Name() == devLibraryName(fc) {
+		return true
+	}
+	testonly, ok := r.Attr("testonly").(*bzl.Ident)
+	return ok && testonly.Name == "True"
+}
+
+// devLibraryName returns the name of the generated testonly library.
+func devLibraryName(fc *FlutterConfig) string {
+	return fc.LibraryName + "_dev"
+}
+
+// unionSorted returns the sorted union of two string lists.
+func unionSorted(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var out []string
+	for _, list := range [][]string{a, b} {
+		for _, v := range list {
+			if !seen[v] {
+				seen[v] = true
+				out = append(out, v)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// testRuleName returns the name of the generated flutter_test target.
+func testRuleName(fc *FlutterConfig) string {
+	return fc.LibraryName + "_test"
+}
+
+// generateDeps creates lists of dependency labels from pub_deps.json. Direct
+// main and overridden dependencies are returned in deps, direct dev
+// dependencies in devDeps. Path dependencies are left to Resolve; see
+// pathDependencies.
+func generateDeps(depsFile *PubDeps, fc *FlutterConfig, rel string) (deps, devDeps []string) {
 	directDeps := GetDirectDependencies(depsFile)
 	if len(directDeps) == 0 {
-		return nil
+		return nil, nil
 	}
 
-	deps := make([]string, 0, len(directDeps))
 	for pkg, meta := range directDeps {
 		depKind := meta.Dependency
 		if !strings.HasPrefix(depKind, "direct") {
 			continue
 		}
 
-		switch meta.Source {
-		case "hosted":
-			repoName := SanitizeRepoName(pkg)
-			deps = append(deps, fmt.Sprintf("@%s//:%s", repoName, pkg))
-		case "sdk":
-			if sdkLabel := sdkDependencyLabel(pkg, fc); sdkLabel != "" {
-				deps = append(deps, sdkLabel)
-			}
-		case "path":
-			if pathLabel := pathDependencyLabel(meta, fc, rel); pathLabel != "" {
-				deps = append(deps, pathLabel)
-			}
+		dep := pubDependencyLabel(pkg, meta, fc, rel)
+		if dep == "" {
+			continue
+		}
+
+		if depKind == "direct dev" {
+			devDeps = append(devDeps, dep)
+		} else {
+			deps = append(deps, dep)
 		}
 	}
 
 	// Sort for consistent output
 	sort.Strings(deps)
-	return deps
+	sort.Strings(devDeps)
+	return deps, devDeps
 }
 
-// pathDependencyLabel returns the Bazel label for a local path dependency.
-func pathDependencyLabel(pkg PubDepsPackage, fc *FlutterConfig, rel string) string {
+// pubDependencyLabel returns the label for a direct dependency from
+// pub_deps.json, or "" when it can't be mapped. A flutter_resolve directive
+// for the package takes precedence over its source.
+func pubDependencyLabel(pkg string, meta PubDepsPackage, fc *FlutterConfig, rel string) string {
+	if l, ok := fc.Resolves[pkg]; ok {
+		return formatLabel(l.Rel("", rel))
+	}
+	switch meta.Source {
+	case "hosted":
+		return hostedDependencyLabel(pkg, HostedURL(meta), fc)
+	case "sdk":
+		l, ok := sdkDependencyLabel(pkg, fc)
+		if !ok {
+			logUnknownSDKPackage("//"+rel, pkg, sdkName(meta))
+		}
+		return l
+	case "git":
+		return gitDependencyLabel(meta, fc, rel)
+	}
+	return ""
+}
+
+// pathDependencies returns the direct path dependencies in depsFile that no
+// flutter_resolve directive covers, mapped to their expected library labels
+// and split like generateDeps. Unmappable paths are reported and dropped.
+func pathDependencies(depsFile *PubDeps, fc *FlutterConfig, rel string) (deps, devDeps map[string]label.Label) {
+	for pkg, meta := range GetDirectDependencies(depsFile) {
+		if meta.Source != "path" {
+			continue
+		}
+		if _, ok := fc.Resolves[pkg]; ok {
+			continue
+		}
+		l, ok := pathDependencyLabel(meta, fc, rel)
+		if !ok {
+			continue
+		}
+		if meta.Dependency == "direct dev" {
+			if devDeps == nil {
+				devDeps = make(map[string]label.Label)
+			}
+			devDeps[pkg] = l
+		} else {
+			if deps == nil {
+				deps = make(map[string]label.Label)
+			}
+			deps[pkg] = l
+		}
+	}
+	return deps, devDeps
+}
+
+// pathDependencyLabel returns the expected label of a path dependency's
+// library: in the workspace, or in the repository a flutter_path_repo
+// directive or local_path_override maps its directory to. It reports false,
+// with a warning, when the path leaves the workspace unmapped.
+func pathDependencyLabel(pkg PubDepsPackage, fc *FlutterConfig, rel string) (label.Label, bool) {
 	pathValue := ""
 	switch desc := pkg.Description.(type) {
 	case string:
@@ -183,50 +551,79 @@ func pathDependencyLabel(pkg PubDepsPackage, fc *FlutterConfig, rel string) stri
 		}
 	}
 	if pathValue == "" {
-		return ""
+		return label.NoLabel, false
 	}
 
-	cleanPath := filepath.Clean(filepath.Join(rel, pathValue))
-	if cleanPath == "." || strings.HasPrefix(cleanPath, "..") {
-		return ""
+	slashPath := filepath.ToSlash(pathValue)
+	cleanPath := path.Clean(slashPath)
+	if !path.IsAbs(slashPath) {
+		cleanPath = path.Clean(path.Join(rel, slashPath))
 	}
-
-	targetName := "lib"
-	if fc != nil && fc.LibraryName != "" {
-		targetName = fc.LibraryName
+	if path.IsAbs(cleanPath) || cleanPath == ".." || strings.HasPrefix(cleanPath, "../") {
+		if l, ok := fc.pathRepoLabel(cleanPath); ok {
+			return l, true
+		}
+		log.Printf("//%s: path dependency %s (%s) is outside the workspace and cannot be resolved to a Bazel label; map it with a %s or %s directive or a local_path_override", rel, pkg.Name, pathValue, DirectivePathRepo, DirectiveResolve)
+		return label.NoLabel, false
+	}
+	if cleanPath == "." {
+		cleanPath = ""
 	}
-	return fmt.Sprintf("//%s:%s", filepath.ToSlash(cleanPath), targetName)
+	return label.New("", cleanPath, fc.LibraryName), true
 }
 
-// sdkDependencyLabel returns the Bazel label for an SDK provided package.
-func sdkDependencyLabel(pkg string, fc *FlutterConfig) string {
-	if fc == nil || fc.SDKRepo == "" {
-		return ""
+// mergePathDeps returns the union of two path dependency maps.
+func mergePathDeps(a, b map[string]label.Label) map[string]label.Label {
+	if len(b) == 0 {
+		return a
 	}
-
-	path := sdkPackagePath(pkg)
-	if path == "" {
-		return ""
+	if len(a) == 0 {
+		return b
 	}
-
-	return fmt.Sprintf("%s//%s:%s", fc.SDKRepo, path, pkg)
+	merged := make(map[string]label.Label, len(a)+len(b))
+	for _, m := range []map[string]label.Label{a, b} {
+		for pkg, l := range m {
+			merged[pkg] = l
+		}
+	}
+	return merged
 }
 
-// sdkPackagePath returns the repository relative path for an SDK package target.
-func sdkPackagePath(pkg string) string {
-	switch pkg {
-	case "sky_engine":
-		return fmt.Sprintf("flutter/bin/cache/pkg/%s", pkg)
-	default:
-		return fmt.Sprintf("flutter/packages/%s", pkg)
+// gitDependencyLabel maps a git-sourced package to the repository the pub
+// extension would name for it. The extension only provisions hosted packages,
+// so a repository the root module doesn't declare is reported once every rule
+// has been resolved.
+func gitDependencyLabel(pkg PubDepsPackage, fc *FlutterConfig, rel string) string {
+	var source []string
+	if desc, ok := pkg.Description.(map[string]interface{}); ok {
+		for _, key := range []string{"url", "ref", "path"} {
+			if value, ok := desc[key].(string); ok && value != "" && value != "." {
+				source = append(source, key+"="+value)
+			}
+		}
+	} else if url, ok := pkg.Description.(string); ok {
+		source = append(source, "url="+url)
 	}
+	repo := SanitizeRepoName(pkg.Name)
+	fc.pubRepos.gitRepo(repo, fmt.Sprintf("%s is a git dependency of //%s (%s)", pkg.Name, rel, strings.Join(source, ", ")))
+	return pubRepoLabel(repo, pkg.Name)
 }
 
-// Imports extracts import statements from Flutter/Dart source files
+// Imports returns the pubspec package name of flutter_library and
+// dart_library rules so other packages can resolve to them.
 func (fl *flutterLang) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.ImportSpec {
-	// For now, we don't need to parse Dart imports
-	// The dependencies are extracted from pub_deps.json
-	return []resolve.ImportSpec{}
+	if !isLibraryKind(r.Kind()) {
+		return nil
+	}
+	if isDevLibrary(r, GetFlutterConfig(c)) {
+		return nil
+	}
+
+	name := pubspecPackageName(r, f)
+	if name == "" {
+		return nil
+	}
+	return []resolve.ImportSpec{{Lang: languageName, Imp: name}}
 }
 
 // Embeds is not used for Flutter
@@ -236,44 +633,30 @@ func (fl *flutterLang) Embeds(r *rule.Rule, from label.Label) []label.Label {
 
 // Resolve resolves imports to labels
 func (fl *flutterLang) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, r *rule.Rule, importsRaw interface{}, from label.Label) {
-	// Dependencies are already resolved in GenerateRules
-	// This is called after generation to finalize labels
-}
-
-// parseImports parses Dart import statements from source code
-// Returns a list of import paths
-func parseImports(content string) []string {
-	var imports []string
-
-	lines := strings.Split(content, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-
-		// Look for import statements: import 'package:...' or import "package:..."
-		if strings.HasPrefix(line, "import ") {
-			// Extract the quoted string
-			start := strings.Index(line, "'")
-			if start == -1 {
-				start = strings.Index(line, "\"")
-			}
-			if start == -1 {
-				continue
-			}
-
-			quote := line[start]
-			end := strings.Index(line[start+1:], string(quote))
-			if end == -1 {
-				continue
-			}
-
-			importPath := line[start+1 : start+1+end]
+	in, ok := importsRaw.(resolveInputs)
+	if !ok || !isLibraryKind(r.Kind()) {
+		return
+	}
 
-			// Only include package: imports
-			if strings.HasPrefix(importPath, "package:") {
-				imports = append(imports, importPath)
+	fc := GetFlutterConfig(c)
+	if fc.DepsMode != DepsModeImports {
+		// Dependencies from pub_deps.json are already set in GenerateRules,
+		// except for path dependencies, which need the rule index.
+		if len(in.PathDeps) > 0 {
+			pathIn := resolveInputs{PackageName: in.PackageName, PathDeps: in.PathDeps}
+			for pkg := range in.PathDeps {
+				pathIn.Packages = append(pathIn.Packages, pkg)
 			}
+			deps := mergeLabels(r.AttrStrings("deps"), resolvePackages(c, ix, pathIn, from))
+			r.SetAttr("deps", deps)
 		}
+		return
 	}
 
-	return imports
+	deps := resolvePackages(c, ix, in, from)
+	if len(deps) > 0 {
+		r.SetAttr("deps", deps)
+	} else {
+		r.DelAttr("deps")
+	}
 }
@@ -1,39 +1,65 @@
 package flutter
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/merger"
+	"github.com/bazelbuild/bazel-gazelle/rule"
 )
 
-func TestGenerateDepsIncludesAllDirectDependencies(t *testing.T) {
+func TestGenerateDepsSplitsDevDependencies(t *testing.T) {
 	deps := &PubDeps{
 		Packages: []PubDepsPackage{
 			{Name: "vector_math", Dependency: "direct main", Source: "hosted"},
 			{Name: "flutter_test", Dependency: "direct dev", Source: "sdk"},
 			{Name: "flutter", Dependency: "direct main", Source: "sdk"},
 			{Name: "flutter_lints", Dependency: "direct dev", Source: "hosted"},
+			{Name: "meta", Dependency: "direct overridden", Source: "hosted"},
 			{
 				Name:        "local_models",
 				Dependency:  "direct main",
 				Source:      "path",
 				Description: map[string]interface{}{"path": "../local_models"},
 			},
+			{
+				Name:       "forked_widgets",
+				Dependency: "direct main",
+				Source:     "git",
+				Description: map[string]interface{}{
+					"url":  "https://github.com/example/widgets.git",
+					"ref":  "main",
+					"path": "packages/forked_widgets",
+				},
+			},
 			{Name: "collection", Dependency: "transitive", Source: "hosted"},
 		},
 	}
 
 	fc := &FlutterConfig{SDKRepo: "@flutter_sdk"}
-	got := generateDeps(deps, fc, "apps/example")
+	got, gotDev := generateDeps(deps, fc, "apps/example")
 	want := []string{
-		"//apps/local_models:lib",
-		"@flutter_sdk//flutter/packages/flutter:flutter",
-		"@flutter_sdk//flutter/packages/flutter_test:flutter_test",
-		"@pub_flutter_lints//:flutter_lints",
+		"@flutter_sdk//flutter/packages/flutter",
+		"@pub_forked_widgets//:forked_widgets",
+		"@pub_meta//:meta",
 		"@pub_vector_math//:vector_math",
 	}
+	wantDev := []string{
+		"@flutter_sdk//flutter/packages/flutter_test",
+		"@pub_flutter_lints//:flutter_lints",
+	}
 
 	if !reflect.DeepEqual(got, want) {
-		t.Fatalf("generateDeps(...):\nwant %v\n got %v", want, got)
+		t.Fatalf("generateDeps(...) deps:\nwant %v\n got %v", want, got)
+	}
+	if !reflect.DeepEqual(gotDev, wantDev) {
+		t.Fatalf("generateDeps(...) devDeps:\nwant %v\n got %v", wantDev, gotDev)
 	}
 }
 
@@ -65,8 +91,8 @@ func TestGetDirectDependenciesIncludesAllDirectKinds(t *testing.T) {
 
 func TestSDKDependencyLabelDefaultPackage(t *testing.T) {
 	fc := &FlutterConfig{SDKRepo: "@flutter_sdk"}
-	got := sdkDependencyLabel("flutter", fc)
-	want := "@flutter_sdk//flutter/packages/flutter:flutter"
+	got, _ := sdkDependencyLabel("flutter", fc)
+	want := "@flutter_sdk//flutter/packages/flutter"
 
 	if got != want {
 		t.Fatalf("sdkDependencyLabel(...): want %q got %q", want, got)
@@ -75,10 +101,592 @@ func TestSDKDependencyLabelDefaultPackage(t *testing.T) {
 
 func TestSDKDependencyLabelSkyEngine(t *testing.T) {
 	fc := &FlutterConfig{SDKRepo: "@flutter_sdk"}
-	got := sdkDependencyLabel("sky_engine", fc)
-	want := "@flutter_sdk//flutter/bin/cache/pkg/sky_engine:sky_engine"
+	got, _ := sdkDependencyLabel("sky_engine", fc)
+	want := "@flutter_sdk//flutter/bin/cache/pkg/sky_engine"
 
 	if got != want {
 		t.Fatalf("sdkDependencyLabel(...): want %q got %q", want, got)
 	}
 }
+
+func TestGenerateDepsMapsSDKPackages(t *testing.T) {
+	deps := &PubDeps{
+		Packages: []PubDepsPackage{
+			{Name: "flutter_localizations", Dependency: "direct main", Source: "sdk", Description: "flutter"},
+			{Name: "flutter_web_plugins", Dependency: "direct main", Source: "sdk", Description: "flutter"},
+			{Name: "flutter_gpu", Dependency: "direct main", Source: "sdk", Description: "flutter"},
+			{Name: "_macros", Dependency: "direct main", Source: "sdk", Description: "dart"},
+			{Name: "vm_service_protos", Dependency: "direct main", Source: "sdk", Description: "dart"},
+			{Name: "integration_test", Dependency: "direct dev", Source: "sdk", Description: "flutter"},
+			{Name: "flutter_driver", Dependency: "direct dev", Source: "sdk", Description: "flutter"},
+		},
+	}
+
+	fc := &FlutterConfig{SDKRepo: "@flutter_sdk", SDKPackages: map[string]string{
+		"vm_service_protos": "flutter/bin/cache/dart-sdk/pkg/vm_service_protos",
+	}}
+	got, gotDev := generateDeps(deps, fc, "app")
+
+	// Unknown SDK packages are reported rather than guessed, and _macros is
+	// resolved by the SDK itself.
+	want := []string{
+		"@flutter_sdk//flutter/bin/cache/dart-sdk/pkg/vm_service_protos",
+		"@flutter_sdk//flutter/packages/flutter_localizations",
+		"@flutter_sdk//flutter/packages/flutter_web_plugins",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("generateDeps(...) deps: want %v got %v", want, got)
+	}
+	wantDev := []string{
+		"@flutter_sdk//flutter/packages/flutter_driver",
+		"@flutter_sdk//flutter/packages/integration_test",
+	}
+	if !reflect.DeepEqual(gotDev, wantDev) {
+		t.Fatalf("generateDeps(...) devDeps: want %v got %v", wantDev, gotDev)
+	}
+}
+
+func TestGenerateRulesEmitsFlutterTest(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":            "name: example\nenvironment:\n  flutter: '>=3.24.0'\n",
+		"lib/main.dart":           "void main() {}\n",
+		"test/widget_test.dart":   "void main() {}\n",
+		"test/fixtures/data.json": "{}\n",
+		"integration_test.dart":   "void main() {}\n",
+	})
+
+	result := (&flutterLang{}).GenerateRules(generateArgs(t, dir, "example"))
+	if len(result.Gen) != 2 || len(result.Imports) != 2 {
+		t.Fatalf("expected library and test rules, got %d rules and %d imports", len(result.Gen), len(result.Imports))
+	}
+
+	test := result.Gen[1]
+	if test.Kind() != "flutter_test" || test.Name() != "lib_test" {
+		t.Fatalf("unexpected test rule %s(%s)", test.Kind(), test.Name())
+	}
+	wantSrcs := []string{"integration_test.dart", "test/fixtures/data.json", "test/widget_test.dart"}
+	if got := test.AttrStrings("srcs"); !reflect.DeepEqual(got, wantSrcs) {
+		t.Fatalf("flutter_test srcs: want %v got %v", wantSrcs, got)
+	}
+	if got := test.AttrStrings("embed"); !reflect.DeepEqual(got, []string{":lib"}) {
+		t.Fatalf("flutter_test embed: want [:lib] got %v", got)
+	}
+	wantTestFiles := []string{"test/", "integration_test.dart"}
+	if got := test.AttrStrings("test_files"); !reflect.DeepEqual(got, wantTestFiles) {
+		t.Fatalf("flutter_test test_files: want %v got %v", wantTestFiles, got)
+	}
+}
+
+func TestGenerateRulesSkipsTestWithoutTestSources(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":         "name: example\n",
+		"lib/main.dart":        "void main() {}\n",
+		"test/fixtures/a.json": "{}\n",
+	})
+
+	result := (&flutterLang{}).GenerateRules(generateArgs(t, dir, "example"))
+	if len(result.Gen) != 1 {
+		t.Fatalf("expected only the library rule, got %d rules", len(result.Gen))
+	}
+}
+
+// writePackage materializes files (slash-separated relative paths) in a
+// temporary directory and returns its path.
+func writePackage(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for rel, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// generateArgs builds GenerateArgs for dir the way Gazelle's walk would.
+func generateArgs(t *testing.T, dir, rel string) language.GenerateArgs {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{Exts: map[string]interface{}{}}
+	cfg.Exts[languageName] = &FlutterConfig{
+		LibraryName: "lib",
+		Generate:    true,
+		SDKRepo:     "@flutter_sdk",
+	}
+
+	args := language.GenerateArgs{Config: cfg, Dir: dir, Rel: rel}
+	for _, e := range entries {
+		if e.IsDir() {
+			args.Subdirs = append(args.Subdirs, e.Name())
+		} else {
+			args.RegularFiles = append(args.RegularFiles, e.Name())
+		}
+	}
+	return args
+}
+
+func TestGenerateRulesFallsBackToPubspecDependencies(t *testing.T) {
+	for name, files := range map[string]map[string]string{
+		"missing pub_deps.json": {},
+		"invalid pub_deps.json": {"pub_deps.json": "{not json"},
+		"empty pub_deps.json":   {"pub_deps.json": `{"packages": []}`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			files["pubspec.yaml"] = `name: example
+environment:
+  flutter: ">=3.24.0"
+dependencies:
+  flutter:
+    sdk: flutter
+  collection: ^1.18.0
+`
+			files["lib/main.dart"] = "void main() {}\n"
+			dir := writePackage(t, files)
+
+			result := (&flutterLang{}).GenerateRules(generateArgs(t, dir, "example"))
+			want := []string{
+				"@flutter_sdk//flutter/packages/flutter",
+				"@pub_collection//:collection",
+			}
+			if got := result.Gen[0].AttrStrings("deps"); !reflect.DeepEqual(got, want) {
+				t.Fatalf("deps: want %v got %v", want, got)
+			}
+			if got := result.Gen[0].AttrString("pub_deps"); got != "" {
+				t.Fatalf("pub_deps: want none got %q", got)
+			}
+		})
+	}
+}
+
+func TestGenerateRulesReadsPubDepsKinds(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml": "name: example\nenvironment:\n  flutter: \">=3.24.0\"\n",
+		"pub_deps.json": `{"root": "example", "packages": [
+  {"name": "example", "kind": "root", "source": "root"},
+  {"name": "flutter", "kind": "direct", "source": "sdk"},
+  {"name": "collection", "kind": "direct", "source": "hosted"},
+  {"name": "flutter_test", "kind": "dev", "source": "sdk"},
+  {"name": "meta", "kind": "transitive", "source": "hosted"}
+]}`,
+		"lib/main.dart": "void main() {}\n",
+	})
+	args := generateArgs(t, dir, "example")
+	f, err := rule.LoadData(filepath.Join(dir, "BUILD.bazel"), "example", []byte(`
+flutter_library(
+    name = "lib",
+    srcs = ["lib/main.dart"],
+    pubspec = "pubspec.yaml",
+    deps = [
+        "@flutter_sdk//flutter/packages/flutter",
+        "@flutter_sdk//flutter/packages/flutter_test",
+        "@pub_collection//:collection",
+    ],
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args.File = f
+	fl := &flutterLang{}
+	res := fl.GenerateRules(args)
+	merger.MergeFile(f, res.Empty, res.Gen, merger.PreResolve, fl.Kinds())
+
+	want := []string{
+		"@flutter_sdk//flutter/packages/flutter",
+		"@pub_collection//:collection",
+	}
+	if got := f.Rules[0].AttrStrings("deps"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("deps after merge: want %v got %v", want, got)
+	}
+	if got := f.Rules[0].AttrString("pub_deps"); got != "pub_deps.json" {
+		t.Fatalf("pub_deps: want pub_deps.json got %q", got)
+	}
+}
+
+func TestGenerateRulesSplitsDevDependenciesIntoTestonlyLibrary(t *testing.T) {
+	dir := writePackage(t, devDepsPackage)
+
+	result := (&flutterLang{}).GenerateRules(generateArgs(t, dir, "example"))
+	lib := findRule(result.Gen, "flutter_library", "lib")
+	dev := findRule(result.Gen, "flutter_library", "lib_dev")
+	test := findRule(result.Gen, "flutter_test", "lib_test")
+	if lib == nil || dev == nil || test == nil {
+		t.Fatalf("expected lib, lib_dev and lib_test rules, got %v", result.Gen)
+	}
+	if len(result.Imports) != len(result.Gen) {
+		t.Fatalf("expected one imports entry per rule, got %d for %d rules", len(result.Imports), len(result.Gen))
+	}
+
+	if got, want := lib.AttrStrings("deps"), []string{"@flutter_sdk//flutter/packages/flutter"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("lib deps: want %v got %v", want, got)
+	}
+	wantDev := []string{
+		"@flutter_sdk//flutter/packages/flutter",
+		"@flutter_sdk//flutter/packages/flutter_test",
+	}
+	if got := dev.AttrStrings("deps"); !reflect.DeepEqual(got, wantDev) {
+		t.Errorf("lib_dev deps: want %v got %v", wantDev, got)
+	}
+	if got := dev.AttrStrings("srcs"); !reflect.DeepEqual(got, []string{"lib/main.dart"}) {
+		t.Errorf("lib_dev srcs: want [lib/main.dart] got %v", got)
+	}
+	if got := test.AttrStrings("embed"); !reflect.DeepEqual(got, []string{":lib_dev"}) {
+		t.Errorf("lib_test embed: want [:lib_dev] got %v", got)
+	}
+}
+
+func TestGenerateRulesMergesDevDependenciesOnDirective(t *testing.T) {
+	dir := writePackage(t, devDepsPackage)
+	args := generateArgs(t, dir, "example")
+	GetFlutterConfig(args.Config).DevDeps = DevDepsMerge
+
+	result := (&flutterLang{}).GenerateRules(args)
+	if dev := findRule(result.Gen, "flutter_library", "lib_dev"); dev != nil {
+		t.Fatalf("did not expect a lib_dev rule in merge mode")
+	}
+	want := []string{
+		"@flutter_sdk//flutter/packages/flutter",
+		"@flutter_sdk//flutter/packages/flutter_test",
+	}
+	if got := result.Gen[0].AttrStrings("deps"); !reflect.DeepEqual(got, want) {
+		t.Errorf("lib deps: want %v got %v", want, got)
+	}
+	if got := findRule(result.Gen, "flutter_test", "lib_test").AttrStrings("embed"); !reflect.DeepEqual(got, []string{":lib"}) {
+		t.Errorf("lib_test embed: want [:lib] got %v", got)
+	}
+}
+
+func TestGenerateRulesSplitsTestImportsInImportsMode(t *testing.T) {
+	dir := writePackage(t, devDepsPackage)
+	args := generateArgs(t, dir, "example")
+	GetFlutterConfig(args.Config).DepsMode = DepsModeImports
+
+	result := (&flutterLang{}).GenerateRules(args)
+	var devImports resolveInputs
+	for i, r := range result.Gen {
+		if r.Name() == "lib_dev" {
+			devImports = result.Imports[i].(resolveInputs)
+		}
+	}
+	if want := []string{"flutter", "flutter_test"}; !reflect.DeepEqual(devImports.Packages, want) {
+		t.Fatalf("lib_dev imports: want %v got %v", want, devImports.Packages)
+	}
+	if got := result.Imports[0].(resolveInputs).Packages; !reflect.DeepEqual(got, []string{"flutter"}) {
+		t.Fatalf("lib imports: want [flutter] got %v", got)
+	}
+}
+
+var devDepsPackage = map[string]string{
+	"pubspec.yaml": `name: example
+environment:
+  flutter: ">=3.24.0"
+dependencies:
+  flutter:
+    sdk: flutter
+dev_dependencies:
+  flutter_test:
+    sdk: flutter
+`,
+	"lib/main.dart":         "import 'package:flutter/widgets.dart';\n",
+	"test/widget_test.dart": "import 'package:flutter_test/flutter_test.dart';\n",
+}
+
+func TestGenerateRulesFiltersExcludedFiles(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":             "name: example\n",
+		"lib/main.dart":            "",
+		"lib/src/gen/api.dart":     "",
+		"lib/src/model.dart":       "",
+		"test/widget_test.dart":    "",
+		"test/fixtures/big/a.dart": "",
+	})
+	args := generateArgs(t, dir, "apps/example")
+	fc := GetFlutterConfig(args.Config)
+	fc.Exclude = []ExcludePattern{
+		{Dir: "apps", Pattern: "example/lib/**/gen"},
+		{Dir: "", Pattern: "**/fixtures"},
+	}
+
+	result := (&flutterLang{}).GenerateRules(args)
+
+	lib := findRule(result.Gen, "flutter_library", "lib")
+	if lib == nil {
+		t.Fatalf("expected a flutter_library, got %v", result.Gen)
+	}
+	if got, want := lib.AttrStrings("srcs"), []string{"lib/main.dart", "lib/src/model.dart"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("library srcs:\nwant %v\n got %v", want, got)
+	}
+	test := findRule(result.Gen, "flutter_test", "lib_test")
+	if test == nil {
+		t.Fatalf("expected a flutter_test, got %v", result.Gen)
+	}
+	if got, want := test.AttrStrings("srcs"), []string{"test/widget_test.dart"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("test srcs:\nwant %v\n got %v", want, got)
+	}
+}
+
+func TestGenerateDepsMapsPrivateHostedServers(t *testing.T) {
+	deps := &PubDeps{
+		Packages: []PubDepsPackage{
+			{
+				Name:        "auth",
+				Dependency:  "direct main",
+				Source:      "hosted",
+				Description: map[string]interface{}{"name": "auth", "url": "https://pub.corp.example/"},
+			},
+			{
+				Name:        "http",
+				Dependency:  "direct main",
+				Source:      "hosted",
+				Description: map[string]interface{}{"name": "http", "url": "https://pub.dev"},
+			},
+		},
+	}
+
+	fc := &FlutterConfig{HostedRepos: map[string]string{"https://pub.corp.example": "@corp_pub_"}}
+	got, _ := generateDeps(deps, fc, "app")
+	want := []string{"@corp_pub_auth//:auth", "@pub_http//:http"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("generateDeps(...): want %v got %v", want, got)
+	}
+}
+
+func TestGenerateDepsHonorsResolveDirective(t *testing.T) {
+	deps := &PubDeps{
+		Packages: []PubDepsPackage{
+			{Name: "foo", Dependency: "direct main", Source: "hosted"},
+			{Name: "flutter_test", Dependency: "direct dev", Source: "sdk"},
+		},
+	}
+
+	fc := &FlutterConfig{SDKRepo: "@flutter_sdk", Resolves: map[string]label.Label{
+		"foo":          label.New("", "third_party/dart/foo", "foo"),
+		"flutter_test": label.New("", "app", "test_support"),
+	}}
+	got, gotDev := generateDeps(deps, fc, "app")
+	if want := []string{"//third_party/dart/foo"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("generateDeps(...) deps: want %v got %v", want, got)
+	}
+	if want := []string{":test_support"}; !reflect.DeepEqual(gotDev, want) {
+		t.Fatalf("generateDeps(...) devDeps: want %v got %v", want, gotDev)
+	}
+}
+
+func TestPathDependenciesAreRepositoryRelative(t *testing.T) {
+	deps := &PubDeps{
+		Packages: []PubDepsPackage{
+			{Name: "models", Dependency: "direct main", Source: "path", Description: map[string]interface{}{"path": "../../packages/models"}},
+			{Name: "fixtures", Dependency: "direct dev", Source: "path", Description: map[string]interface{}{"path": "test/fixtures"}},
+			{Name: "root", Dependency: "direct main", Source: "path", Description: map[string]interface{}{"path": "../.."}},
+			{Name: "shared", Dependency: "direct main", Source: "path", Description: map[string]interface{}{"path": "../../../shared"}},
+			{Name: "vendored", Dependency: "direct main", Source: "path", Description: map[string]interface{}{"path": "../vendored"}},
+		},
+	}
+
+	fc := &FlutterConfig{
+		LibraryName: "lib",
+		Resolves:    map[string]label.Label{"vendored": label.New("", "third_party/vendored", "vendored")},
+	}
+	got, gotDev := pathDependencies(deps, fc, "apps/example")
+	want := map[string]label.Label{
+		"models": label.New("", "packages/models", "lib"),
+		"root":   label.New("", "", "lib"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("pathDependencies(...) deps: want %v got %v", want, got)
+	}
+	if want := map[string]label.Label{"fixtures": label.New("", "apps/example/test/fixtures", "lib")}; !reflect.DeepEqual(gotDev, want) {
+		t.Fatalf("pathDependencies(...) devDeps: want %v got %v", want, gotDev)
+	}
+}
+
+func TestPathDependenciesOutsideWorkspaceMapToRepositories(t *testing.T) {
+	deps := &PubDeps{
+		Packages: []PubDepsPackage{
+			{Name: "models", Dependency: "direct main", Source: "path", Description: map[string]interface{}{"path": "../../../shared/models"}},
+			{Name: "shared", Dependency: "direct main", Source: "path", Description: map[string]interface{}{"path": "../../../shared"}},
+			{Name: "design", Dependency: "direct main", Source: "path", Description: map[string]interface{}{"path": "../../../shared/ui/design"}},
+			{Name: "stray", Dependency: "direct main", Source: "path", Description: map[string]interface{}{"path": "../../../elsewhere"}},
+		},
+	}
+
+	fc := &FlutterConfig{
+		LibraryName: "lib",
+		PathRepos:   map[string]string{"../shared": "@shared", "../shared/ui": "@shared_ui"},
+	}
+	got, _ := pathDependencies(deps, fc, "apps/example")
+	want := map[string]label.Label{
+		"models": label.New("shared", "models", "lib"),
+		"shared": label.New("shared", "", "lib"),
+		"design": label.New("shared_ui", "design", "lib"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("pathDependencies(...): want %v got %v", want, got)
+	}
+}
+
+// staleBuildFile is a BUILD file as Gazelle generated it for a package with
+// tests and dev dependencies, plus a hand-written library.
+const staleBuildFile = `
+flutter_library(
+    name = "lib",
+    srcs = ["lib/main.dart"],
+    pubspec = "pubspec.yaml",
+    deps = ["@flutter_sdk//flutter/packages/flutter"],
+)
+
+flutter_library(
+    name = "lib_dev",
+    testonly = True,
+    srcs = ["lib/main.dart"],
+    pubspec = "pubspec.yaml",
+    deps = ["@flutter_sdk//flutter/packages/flutter_test"],
+)
+
+flutter_test(
+    name = "lib_test",
+    srcs = ["test/main_test.dart"],
+    embed = [":lib_dev"],
+)
+
+dart_library(
+    name = "helpers",
+    srcs = ["helpers.dart"],
+)
+`
+
+// mergeGenerated runs GenerateRules over dir with file as its existing BUILD
+// file and merges the result the way Gazelle does, returning what is left.
+func mergeGenerated(t *testing.T, args language.GenerateArgs, content string) []string {
+	t.Helper()
+	f, err := rule.LoadData(filepath.Join(args.Dir, "BUILD.bazel"), args.Rel, []byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args.File = f
+	fl := &flutterLang{}
+	res := fl.GenerateRules(args)
+	merger.MergeFile(f, res.Empty, res.Gen, merger.PreResolve, fl.Kinds())
+
+	var names []string
+	for _, r := range f.Rules {
+		names = append(names, r.Kind()+" "+r.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestGenerateRulesDeletesTargetsWhenPubspecDisappears(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"lib/main.dart":       "void main() {}\n",
+		"test/main_test.dart": "void main() {}\n",
+	})
+
+	got := mergeGenerated(t, generateArgs(t, dir, "app"), staleBuildFile)
+	if want := []string{"dart_library helpers"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("rules after merge: want %v got %v", want, got)
+	}
+}
+
+func TestGenerateRulesDeletesTargetsWhenGenerationIsOff(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":        "name: app\nenvironment:\n  flutter: \">=3.0.0\"\n",
+		"lib/main.dart":       "void main() {}\n",
+		"test/main_test.dart": "void main() {}\n",
+	})
+	args := generateArgs(t, dir, "app")
+	GetFlutterConfig(args.Config).Generate = false
+
+	got := mergeGenerated(t, args, staleBuildFile)
+	if want := []string{"dart_library helpers"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("rules after merge: want %v got %v", want, got)
+	}
+}
+
+func TestGenerateRulesKeepsHandWrittenTargetsWhenGenerationIsOff(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":        "name: app\nenvironment:\n  flutter: \">=3.0.0\"\n",
+		"lib/main.dart":       "void main() {}\n",
+		"test/main_test.dart": "void main() {}\n",
+		"web/index.html":      "",
+	})
+	args := generateArgs(t, dir, "app")
+	GetFlutterConfig(args.Config).Generate = false
+
+	got := mergeGenerated(t, args, `
+flutter_library(
+    name = "lib",
+    srcs = ["lib/main.dart"],
+    pubspec = "pubspec.yaml",
+)  # keep
+
+flutter_test(
+    name = "smoke_test",
+    srcs = ["test/main_test.dart"],
+    embed = [":lib"],
+)
+
+flutter_test(
+    name = "lib_test",
+    srcs = ["test/main_test.dart"],
+    embed = [":vendored"],
+)
+
+flutter_app(
+    name = "app",
+    embed = [":lib"],
+    web = ["web/index.html"],
+)
+`)
+	want := []string{"flutter_library lib", "flutter_test lib_test", "flutter_test smoke_test"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("rules after merge: want %v got %v", want, got)
+	}
+}
+
+func TestGenerateRulesKeepsCustomPubspecLabels(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":  "name: app\nenvironment:\n  flutter: \">=3.0.0\"\n",
+		"lib/main.dart": "void main() {}\n",
+	})
+	args := generateArgs(t, dir, "app")
+	f, err := rule.LoadData(filepath.Join(dir, "BUILD.bazel"), "app", []byte(`
+flutter_library(
+    name = "lib",
+    srcs = ["lib/main.dart"],
+    pubspec = ":pubspec_with_overrides",
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args.File = f
+	fl := &flutterLang{}
+	res := fl.GenerateRules(args)
+	merger.MergeFile(f, res.Empty, res.Gen, merger.PreResolve, fl.Kinds())
+
+	if got := f.Rules[0].AttrString("pubspec"); got != ":pubspec_with_overrides" {
+		t.Fatalf("pubspec after merge: want :pubspec_with_overrides got %q", got)
+	}
+}
+
+func TestGenerateRulesDeletesTestTargetsWithoutTests(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":  "name: app\nenvironment:\n  flutter: \">=3.0.0\"\n",
+		"lib/main.dart": "void main() {}\n",
+	})
+
+	got := mergeGenerated(t, generateArgs(t, dir, "app"), staleBuildFile)
+	want := []string{"dart_library helpers", "flutter_library lib"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("rules after merge: want %v got %v", want, got)
+	}
+}
@@ -0,0 +1,105 @@
+package flutter
+
+import (
+	"path"
+	"strings"
+)
+
+// matchGlob reports whether the slash-separated path name matches pattern.
+// Patterns use path.Match syntax within a segment, plus "**" as a whole
+// segment matching zero or more segments, so "**/example" matches "example"
+// and "a/b/example" and "third_party/**" matches everything below
+// third_party. Malformed patterns never match; validate them with
+// validateGlob.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(splitPath(pattern), splitPath(name))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse runs of "**" and try every possible split point.
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := range name {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// validateGlob returns an error if pattern is not a valid glob.
+func validateGlob(pattern string) error {
+	for _, seg := range splitPath(pattern) {
+		if seg == "**" {
+			continue
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitPath splits a slash-separated path into its non-empty segments.
+func splitPath(p string) []string {
+	if p == "" || p == "." {
+		return nil
+	}
+	var segs []string
+	for _, seg := range strings.Split(p, "/") {
+		if seg != "" && seg != "." {
+			segs = append(segs, seg)
+		}
+	}
+	return segs
+}
+
+// relativeGlobs returns patterns that match, relative to the directory
+// prefix, the paths below it that pattern matches. A "**" in pattern may
+// cover part of prefix, so several patterns can result; none means pattern
+// never matches below prefix.
+func relativeGlobs(pattern, prefix string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, segs := range stripGlobPrefix(splitPath(pattern), splitPath(prefix)) {
+		if p := strings.Join(segs, "/"); p != "" && !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func stripGlobPrefix(pattern, prefix []string) [][]string {
+	if len(prefix) == 0 {
+		return [][]string{pattern}
+	}
+	if len(pattern) == 0 {
+		return nil
+	}
+	if pattern[0] == "**" {
+		// "**" either matches nothing more of prefix, or swallows its next
+		// segment and possibly more.
+		return append(stripGlobPrefix(pattern[1:], prefix), stripGlobPrefix(pattern, prefix[1:])...)
+	}
+	if ok, err := path.Match(pattern[0], prefix[0]); err != nil || !ok {
+		return nil
+	}
+	return stripGlobPrefix(pattern[1:], prefix[1:])
+}
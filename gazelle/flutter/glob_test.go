@@ -0,0 +1,59 @@
+package flutter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"example", "example", true},
+		{"example", "a/example", false},
+		{"**/example", "example", true},
+		{"**/example", "a/b/example", true},
+		{"**/example", "a/example/lib", false},
+		{"third_party/**", "third_party/x/y.dart", true},
+		{"third_party/**", "third_party", true},
+		{"third_party/**", "vendor/x", false},
+		{"lib/*.g.dart", "lib/a.g.dart", true},
+		{"lib/*.g.dart", "lib/src/a.g.dart", false},
+		{"lib/**/*.g.dart", "lib/src/a.g.dart", true},
+		{"a/**/**/b", "a/b", true},
+		{"[", "[", false},
+	} {
+		if got := matchGlob(tc.pattern, tc.name); got != tc.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tc.pattern, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestValidateGlob(t *testing.T) {
+	if err := validateGlob("**/example/*.dart"); err != nil {
+		t.Fatalf("validateGlob rejected a valid pattern: %v", err)
+	}
+	if err := validateGlob("lib/[a"); err == nil {
+		t.Fatalf("validateGlob accepted a malformed pattern")
+	}
+}
+
+func TestRelativeGlobs(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, prefix string
+		want            []string
+	}{
+		{"lib/generated", "", []string{"lib/generated"}},
+		{"apps/app/lib/generated", "apps/app", []string{"lib/generated"}},
+		{"apps/*/lib/*.g.dart", "apps/app", []string{"lib/*.g.dart"}},
+		{"apps/other/lib", "apps/app", nil},
+		{"apps/app", "apps/app", nil},
+		{"**/generated", "apps/app", []string{"**/generated"}},
+		{"**/app/lib/gen", "apps/app", []string{"lib/gen", "**/app/lib/gen"}},
+	} {
+		if got := relativeGlobs(tc.pattern, tc.prefix); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("relativeGlobs(%q, %q) = %q, want %q", tc.pattern, tc.prefix, got, tc.want)
+		}
+	}
+}
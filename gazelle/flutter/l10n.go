@@ -0,0 +1,248 @@
+package flutter
+
+import (
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+	"gopkg.in/yaml.v3"
+)
+
+// genL10nCommand is the generator command that runs `flutter gen-l10n` in a
+// library's build action.
+const genL10nCommand = "flutter gen-l10n"
+
+// generatorCommandsValue is the generated generator_commands of a library.
+// Merged into an existing rule, it adds or removes only genL10nCommand and
+// keeps every other command.
+type generatorCommandsValue struct {
+	// genL10n is set when the package generates localizations
+	genL10n bool
+}
+
+// BzlExpr renders the generated commands.
+func (v generatorCommandsValue) BzlExpr() bzl.Expr {
+	var cmds []string
+	if v.genL10n {
+		cmds = append(cmds, genL10nCommand)
+	}
+	return rule.ExprFromValue(cmds)
+}
+
+// Merge adds or removes genL10nCommand in a list in other. Expressions other
+// than plain lists are hand-written and kept as they are.
+func (v generatorCommandsValue) Merge(other bzl.Expr) bzl.Expr {
+	if other == nil {
+		if !v.genL10n {
+			return nil
+		}
+		return v.BzlExpr()
+	}
+	list, ok := other.(*bzl.ListExpr)
+	if !ok {
+		return other
+	}
+	var merged []bzl.Expr
+	present := false
+	for _, x := range list.List {
+		if s, ok := x.(*bzl.StringExpr); ok && s.Value == genL10nCommand {
+			if !v.genL10n && !rule.ShouldKeep(s) {
+				continue
+			}
+			present = true
+		}
+		merged = append(merged, x)
+	}
+	if v.genL10n && !present {
+		merged = append(merged, &bzl.StringExpr{Value: genL10nCommand})
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return &bzl.ListExpr{List: merged, ForceMultiLine: list.ForceMultiLine}
+}
+
+// localizationsPackage is the SDK package generated localizations import.
+const localizationsPackage = "flutter_localizations"
+
+// L10nYaml holds the l10n.yaml settings that decide which files
+// `flutter gen-l10n` reads and writes.
+type L10nYaml struct {
+	ArbDir                 string `yaml:"arb-dir"`
+	TemplateArbFile        string `yaml:"template-arb-file"`
+	OutputDir              string `yaml:"output-dir"`
+	OutputLocalizationFile string `yaml:"output-localization-file"`
+	SyntheticPackage       *bool  `yaml:"synthetic-package"`
+}
+
+// ParseL10nYaml parses an l10n.yaml file and fills in flutter's defaults.
+func ParseL10nYaml(path string) (*L10nYaml, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var l10n L10nYaml
+	if err := yaml.Unmarshal(data, &l10n); err != nil {
+		return nil, err
+	}
+	l10n.setDefaults()
+	return &l10n, nil
+}
+
+// setDefaults fills in the settings flutter gen-l10n assumes when l10n.yaml
+// leaves them out.
+func (l *L10nYaml) setDefaults() {
+	if l.ArbDir == "" {
+		l.ArbDir = "lib/l10n"
+	}
+	if l.TemplateArbFile == "" {
+		l.TemplateArbFile = "app_en.arb"
+	}
+	if l.OutputLocalizationFile == "" {
+		l.OutputLocalizationFile = "app_localizations.dart"
+	}
+	if l.OutputDir == "" {
+		l.OutputDir = l.ArbDir
+	}
+}
+
+// localizations describes a package's flutter gen-l10n setup.
+type localizations struct {
+	// Inputs lists l10n.yaml, if present, and the ARB files, relative to the
+	// package
+	Inputs []string
+
+	// Excludes are glob excludes keeping ARB files and generated output out
+	// of a lib/** srcs glob
+	Excludes []string
+
+	config *L10nYaml
+}
+
+// detectLocalizations returns the gen-l10n setup of the package in dir, or
+// nil when it doesn't generate localizations. A package does when it has an
+// l10n.yaml or sets "generate: true" in pubspec, and has ARB files.
+// regularFiles are the files directly in dir; rel is its repository-relative
+// path.
+func detectLocalizations(dir string, regularFiles []string, pubspec *PubspecYaml, rel string) *localizations {
+	hasL10nYaml := false
+	for _, f := range regularFiles {
+		if f == "l10n.yaml" {
+			hasL10nYaml = true
+		}
+	}
+	generate := pubspec != nil && pubspec.Flutter != nil && pubspec.Flutter.Generate
+	if !hasL10nYaml && !generate {
+		return nil
+	}
+
+	l := &localizations{config: &L10nYaml{}}
+	l.config.setDefaults()
+	if hasL10nYaml {
+		config, err := ParseL10nYaml(filepath.Join(dir, "l10n.yaml"))
+		if err != nil {
+			log.Printf("//%s: l10n.yaml: %v", rel, err)
+			return nil
+		}
+		l.config = config
+		l.Inputs = append(l.Inputs, "l10n.yaml")
+	}
+	if !cleanPackagePath(&l.config.ArbDir) || !cleanPackagePath(&l.config.OutputDir) {
+		log.Printf("//%s: l10n.yaml directories must be inside the package", rel)
+		return nil
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, filepath.FromSlash(l.config.ArbDir)))
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("//%s: %v", rel, err)
+	}
+	var arbs []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".arb") && !isIgnoredFileName(entry.Name()) {
+			arbs = append(arbs, entry.Name())
+		}
+	}
+	if len(arbs) == 0 {
+		if hasL10nYaml {
+			log.Printf("//%s: l10n.yaml is present but %s has no ARB files", rel, l.config.ArbDir)
+		}
+		return nil
+	}
+	if !containsString(arbs, l.config.TemplateArbFile) {
+		log.Printf("//%s: template ARB file %s is missing from %s", rel, l.config.TemplateArbFile, l.config.ArbDir)
+	}
+	switch {
+	case l.config.SyntheticPackage == nil:
+		// Flutter versions that default to the synthetic package write to
+		// .dart_tool/flutter_gen instead of output-dir.
+		log.Printf("//%s: l10n.yaml doesn't set \"synthetic-package\", so Flutter versions defaulting to package:flutter_gen write its output outside the package, where Bazel actions can't resolve it; set \"synthetic-package: false\" in l10n.yaml", rel)
+	case *l.config.SyntheticPackage:
+		log.Printf("//%s: package:flutter_gen can't be resolved inside Bazel actions; set \"synthetic-package: false\" in l10n.yaml", rel)
+	}
+	for _, arb := range arbs {
+		l.Inputs = append(l.Inputs, path.Join(l.config.ArbDir, arb))
+	}
+	sort.Strings(l.Inputs)
+
+	for _, p := range []string{path.Join(l.config.ArbDir, "*.arb"), l.outputGlob(), l.outputLocaleGlob()} {
+		if strings.HasPrefix(p, "lib/") {
+			l.Excludes = append(l.Excludes, p)
+		}
+	}
+	sort.Strings(l.Excludes)
+	return l
+}
+
+// outputGlob matches the generated localizations class.
+func (l *localizations) outputGlob() string {
+	return path.Join(l.config.OutputDir, l.config.OutputLocalizationFile)
+}
+
+// outputLocaleGlob matches the generated per-locale implementations, such as
+// app_localizations_en.dart.
+func (l *localizations) outputLocaleGlob() string {
+	stem := strings.TrimSuffix(l.config.OutputLocalizationFile, ".dart")
+	return path.Join(l.config.OutputDir, stem+"_*.dart")
+}
+
+// withoutGenerated returns files without the ARB files and checked-in
+// gen-l10n output, which the library gets as data and regenerates.
+func (l *localizations) withoutGenerated(files []string) []string {
+	var kept []string
+	for _, f := range files {
+		f := filepath.ToSlash(f)
+		generated := false
+		for _, pattern := range []string{path.Join(l.config.ArbDir, "*.arb"), l.outputGlob(), l.outputLocaleGlob()} {
+			if ok, _ := path.Match(pattern, f); ok {
+				generated = true
+				break
+			}
+		}
+		if !generated {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// cleanPackagePath cleans the slash-separated path *p in place and reports
+// whether it stays inside the package.
+func cleanPackagePath(p *string) bool {
+	*p = path.Clean(strings.TrimPrefix(filepath.ToSlash(*p), "./"))
+	return !path.IsAbs(*p) && *p != ".." && !strings.HasPrefix(*p, "../")
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
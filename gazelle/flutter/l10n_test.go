@@ -0,0 +1,244 @@
+package flutter
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/merger"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+const l10nPubspec = `name: example
+environment:
+  flutter: ">=3.0.0"
+dependencies:
+  flutter:
+    sdk: flutter
+  intl: any
+`
+
+func TestDetectLocalizations(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		files map[string]string
+		want  *localizations
+	}{
+		{
+			name: "no l10n",
+			files: map[string]string{
+				"pubspec.yaml":        "name: example\n",
+				"lib/l10n/app_en.arb": "{}",
+			},
+		},
+		{
+			name: "defaults",
+			files: map[string]string{
+				"pubspec.yaml":        "name: example\nflutter:\n  generate: true\n",
+				"lib/l10n/app_en.arb": "{}",
+				"lib/l10n/app_es.arb": "{}",
+				"lib/l10n/README.md":  "",
+			},
+			want: &localizations{
+				Inputs:   []string{"lib/l10n/app_en.arb", "lib/l10n/app_es.arb"},
+				Excludes: []string{"lib/l10n/*.arb", "lib/l10n/app_localizations.dart", "lib/l10n/app_localizations_*.dart"},
+			},
+		},
+		{
+			name: "l10n.yaml",
+			files: map[string]string{
+				"pubspec.yaml": "name: example\n",
+				"l10n.yaml": `arb-dir: ./i18n
+template-arb-file: intl_en.arb
+output-dir: lib/src/generated
+output-localization-file: strings.dart
+synthetic-package: false
+`,
+				"i18n/intl_en.arb": "{}",
+			},
+			want: &localizations{
+				Inputs:   []string{"i18n/intl_en.arb", "l10n.yaml"},
+				Excludes: []string{"lib/src/generated/strings.dart", "lib/src/generated/strings_*.dart"},
+			},
+		},
+		{
+			name: "l10n.yaml without ARB files",
+			files: map[string]string{
+				"pubspec.yaml": "name: example\n",
+				"l10n.yaml":    "arb-dir: i18n\n",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := writePackage(t, tc.files)
+			var regularFiles []string
+			for f := range tc.files {
+				if !strings.Contains(f, "/") {
+					regularFiles = append(regularFiles, f)
+				}
+			}
+			pubspec, err := ParsePubspecYaml(filepath.Join(dir, "pubspec.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := detectLocalizations(dir, regularFiles, pubspec, "example")
+			if got != nil {
+				got.config = nil
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("want %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestGenerateRulesWiresLocalizations(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":                       l10nPubspec,
+		"l10n.yaml":                          "arb-dir: lib/l10n\nsynthetic-package: false\n",
+		"lib/main.dart":                      "void main() {}\n",
+		"lib/l10n/app_en.arb":                "{}",
+		"lib/l10n/app_localizations.dart":    "",
+		"lib/l10n/app_localizations_en.dart": "",
+		"lib/l10n/messages.dart":             "",
+	})
+
+	lib := findRule((&flutterLang{}).GenerateRules(generateArgs(t, dir, "example")).Gen, "flutter_library", "lib")
+	if lib == nil {
+		t.Fatal("no flutter_library generated")
+	}
+	for attr, want := range map[string][]string{
+		"generator_commands": {"flutter gen-l10n"},
+		"srcs":               {"lib/l10n/messages.dart", "lib/main.dart"},
+		"data":               {"l10n.yaml", "lib/l10n/app_en.arb"},
+		"deps": {
+			"@flutter_sdk//flutter/packages/flutter",
+			"@flutter_sdk//flutter/packages/flutter_localizations",
+			"@pub_intl//:intl",
+		},
+	} {
+		if got := lib.AttrStrings(attr); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: want %v, got %v", attr, want, got)
+		}
+	}
+}
+
+func TestGenerateRulesExcludesLocalizationsFromGlob(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":        "name: example\nenvironment:\n  flutter: \">=3.0.0\"\nflutter:\n  generate: true\n",
+		"lib/main.dart":       "void main() {}\n",
+		"lib/l10n/app_en.arb": "{}",
+	})
+	args := generateArgs(t, dir, "example")
+	GetFlutterConfig(args.Config).SrcsMode = SrcsModeGlob
+
+	lib := findRule((&flutterLang{}).GenerateRules(args).Gen, "flutter_library", "lib")
+	want := `glob(
+    ["lib/**"],
+    exclude = [
+        "lib/**/#*#",
+        "lib/**/*.swo",
+        "lib/**/*.swp",
+        "lib/**/*~",
+        "lib/**/.*",
+        "lib/**/.*/**",
+        "lib/l10n/*.arb",
+        "lib/l10n/app_localizations.dart",
+        "lib/l10n/app_localizations_*.dart",
+    ],
+)`
+	if got := bzl.FormatString(lib.Attr("srcs")); got != want {
+		t.Fatalf("srcs:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDetectLocalizationsWarnsAboutDefaultSyntheticPackage(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	for _, tc := range []struct {
+		l10nYaml string
+		warns    bool
+	}{
+		{l10nYaml: "arb-dir: lib/l10n\n", warns: true},
+		{l10nYaml: "arb-dir: lib/l10n\nsynthetic-package: true\n", warns: true},
+		{l10nYaml: "arb-dir: lib/l10n\nsynthetic-package: false\n"},
+	} {
+		logs.Reset()
+		dir := writePackage(t, map[string]string{
+			"pubspec.yaml":        "name: example\n",
+			"l10n.yaml":           tc.l10nYaml,
+			"lib/l10n/app_en.arb": "{}",
+		})
+		detectLocalizations(dir, []string{"l10n.yaml", "pubspec.yaml"}, nil, "example")
+		if got := strings.Contains(logs.String(), "synthetic-package: false"); got != tc.warns {
+			t.Errorf("%q: warned = %v, want %v; log:\n%s", tc.l10nYaml, got, tc.warns, logs.String())
+		}
+	}
+}
+
+func TestMergeGeneratorCommandsKeepsOtherCommands(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		files    map[string]string
+		existing string
+		want     []string
+	}{
+		{
+			name: "adds gen-l10n",
+			files: map[string]string{
+				"l10n.yaml":           "synthetic-package: false\n",
+				"lib/l10n/app_en.arb": "{}",
+			},
+			existing: `["intl_utils:generate"]`,
+			want:     []string{"intl_utils:generate", "flutter gen-l10n"},
+		},
+		{
+			name:     "removes gen-l10n",
+			existing: `["flutter gen-l10n", "intl_utils:generate"]`,
+			want:     []string{"intl_utils:generate"},
+		},
+		{
+			name:     "removes the attribute",
+			existing: `["flutter gen-l10n"]`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			files := map[string]string{
+				"pubspec.yaml":  l10nPubspec,
+				"lib/main.dart": "void main() {}\n",
+			}
+			for name, content := range tc.files {
+				files[name] = content
+			}
+			dir := writePackage(t, files)
+			args := generateArgs(t, dir, "example")
+			f, err := rule.LoadData(filepath.Join(dir, "BUILD.bazel"), "example", []byte(`
+flutter_library(
+    name = "lib",
+    srcs = ["lib/main.dart"],
+    generator_commands = `+tc.existing+`,
+    pubspec = "pubspec.yaml",
+)
+`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			args.File = f
+			fl := &flutterLang{}
+			res := fl.GenerateRules(args)
+			merger.MergeFile(f, res.Empty, res.Gen, merger.PreResolve, fl.Kinds())
+
+			if got := f.Rules[0].AttrStrings("generator_commands"); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("generator_commands: want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
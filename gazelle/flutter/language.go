@@ -3,6 +3,7 @@ package flutter
 
 import (
 	"flag"
+	"fmt"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
 	"github.com/bazelbuild/bazel-gazelle/language"
@@ -11,7 +12,12 @@ import (
 
 const languageName = "flutter"
 
-type flutterLang struct{}
+type flutterLang struct {
+	language.BaseLifecycleManager
+
+	// pubRepos collects the pub repositories generated labels refer to
+	pubRepos *pubRepoTracker
+}
 
 // NewLanguage returns a new Flutter language extension for Gazelle
 func NewLanguage() language.Language {
@@ -25,17 +31,27 @@ func (fl *flutterLang) Name() string {
 
 // RegisterFlags registers command-line flags for Flutter
 func (fl *flutterLang) RegisterFlags(fs *flag.FlagSet, cmd string, c *config.Config) {
+	fl.pubRepos = &pubRepoTracker{}
+	fs.StringVar(&fl.pubRepos.mode, useRepoFlag, UseRepoWarn,
+		"how to handle pub repositories missing from use_repo in MODULE.bazel: warn, print the use_repo call to add, or fix MODULE.bazel")
+
 	fc := &FlutterConfig{
 		LibraryName: "lib",
 		Generate:    true,
 		SDKRepo:     defaultSDKRepo(c),
+		pubRepos:    fl.pubRepos,
 	}
 	c.Exts[languageName] = fc
 }
 
 // CheckFlags validates the Flutter configuration
 func (fl *flutterLang) CheckFlags(fs *flag.FlagSet, c *config.Config) error {
-	return nil
+	switch fl.pubRepos.mode {
+	case UseRepoWarn, UseRepoPrint, UseRepoFix:
+		return nil
+	default:
+		return fmt.Errorf("-%s must be %q, %q or %q; got %q", useRepoFlag, UseRepoWarn, UseRepoPrint, UseRepoFix, fl.pubRepos.mode)
+	}
 }
 
 // KnownDirectives returns the list of directives recognized by this language
@@ -58,6 +74,13 @@ func (fl *flutterLang) Configure(c *config.Config, rel string, f *rule.File) {
 		}
 	}
 
+	// The root MODULE.bazel maps local module overrides before any
+	// directive can refine them.
+	if rel == "" {
+		fc.configureModule(c)
+		fc.bazelIgnored = loadBazelIgnore(c.RepoRoot)
+	}
+
 	// Apply directives from the BUILD file if present
 	if f != nil {
 		fc.Configure(c, rel, f)
@@ -0,0 +1,268 @@
+package flutter
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// rulesFlutterModule is the module name rules_flutter is published under.
+const rulesFlutterModule = "rules_flutter"
+
+// moduleFile holds the parts of the root MODULE.bazel the Flutter extension
+// reads.
+type moduleFile struct {
+	// apparentNames maps bazel_dep module names to their apparent repository
+	// names (repo_name, defaulting to the module name).
+	apparentNames map[string]string
+
+	// localPaths maps module names to their local_path_override paths.
+	localPaths map[string]string
+
+	// extensionRepos maps rules_flutter extension names ("flutter", "pub") to
+	// the repositories the module imports from them with use_repo, keyed by
+	// the name the extension gives the repository. Values are the apparent
+	// names.
+	extensionRepos map[string]map[string]string
+
+	// extensionProxies maps rules_flutter extension names to the variable
+	// holding the extension's proxy.
+	extensionProxies map[string]string
+
+	// toolchainNames lists the names given to flutter.toolchain tags.
+	toolchainNames []string
+
+	// repos holds the apparent names of the repositories visible to the
+	// module: bazel_dep modules, repositories imported from any extension
+	// with use_repo and those declared with use_repo_rule rules.
+	repos map[string]bool
+}
+
+// loadModuleFile parses MODULE.bazel in repoRoot. It returns nil without an
+// error when the repository has no MODULE.bazel.
+func loadModuleFile(repoRoot string) (*moduleFile, error) {
+	filename := filepath.Join(repoRoot, "MODULE.bazel")
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	f, err := bzl.ParseModule(filename, data)
+	if err != nil {
+		return nil, err
+	}
+	return parseModuleFile(f), nil
+}
+
+// parseModuleFile extracts bazel_dep, local_path_override and rules_flutter
+// extension usage from a parsed MODULE.bazel.
+func parseModuleFile(f *bzl.File) *moduleFile {
+	m := &moduleFile{
+		apparentNames:    make(map[string]string),
+		localPaths:       make(map[string]string),
+		extensionRepos:   make(map[string]map[string]string),
+		extensionProxies: make(map[string]string),
+		repos:            make(map[string]bool),
+	}
+
+	// Extension proxies are matched against rules_flutter's apparent name
+	// once every bazel_dep has been seen.
+	type proxy struct{ bzlFile, extension string }
+	proxies := make(map[string]proxy)
+	repoRules := make(map[string]bool)
+	useRepos := make(map[string][]*bzl.CallExpr)
+	toolchains := make(map[string][]*bzl.CallExpr)
+
+	for _, stmt := range f.Stmt {
+		switch stmt := stmt.(type) {
+		case *bzl.AssignExpr:
+			lhs, ok := stmt.LHS.(*bzl.Ident)
+			call, isCall := stmt.RHS.(*bzl.CallExpr)
+			if !ok || !isCall {
+				continue
+			}
+			if callName(call) == "use_repo_rule" {
+				repoRules[lhs.Name] = true
+				continue
+			}
+			if callName(call) != "use_extension" {
+				continue
+			}
+			args, kwargs := callArgs(call)
+			bzlFile, extension := kwargs["extension_bzl_file"], kwargs["extension_name"]
+			if len(args) > 0 {
+				bzlFile = args[0]
+			}
+			if len(args) > 1 {
+				extension = args[1]
+			}
+			proxies[lhs.Name] = proxy{bzlFile, extension}
+
+		case *bzl.CallExpr:
+			_, kwargs := callArgs(stmt)
+			switch callName(stmt) {
+			case "bazel_dep":
+				if kwargs["name"] == "" {
+					continue
+				}
+				apparent := kwargs["repo_name"]
+				if apparent == "" {
+					apparent = kwargs["name"]
+				}
+				m.apparentNames[kwargs["name"]] = apparent
+				m.repos[apparent] = true
+			case "local_path_override":
+				if kwargs["module_name"] != "" && kwargs["path"] != "" {
+					m.localPaths[kwargs["module_name"]] = kwargs["path"]
+				}
+			case "use_repo":
+				if len(stmt.List) > 0 {
+					if id, ok := stmt.List[0].(*bzl.Ident); ok {
+						useRepos[id.Name] = append(useRepos[id.Name], stmt)
+					}
+				}
+				args, _ := callArgs(stmt)
+				for _, repo := range args {
+					m.repos[repo] = true
+				}
+				for _, arg := range stmt.List {
+					if kw, ok := arg.(*bzl.AssignExpr); ok {
+						if id, ok := kw.LHS.(*bzl.Ident); ok {
+							m.repos[id.Name] = true
+						}
+					}
+				}
+			default:
+				if repoRules[callName(stmt)] && kwargs["name"] != "" {
+					m.repos[kwargs["name"]] = true
+					continue
+				}
+				// Extension tags, e.g. flutter.toolchain(...).
+				if dot, ok := stmt.X.(*bzl.DotExpr); ok && dot.Name == "toolchain" {
+					if id, ok := dot.X.(*bzl.Ident); ok {
+						toolchains[id.Name] = append(toolchains[id.Name], stmt)
+					}
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(proxies))
+	for name := range proxies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := proxies[name]
+		if !m.isRulesFlutterExtension(p.bzlFile) {
+			continue
+		}
+		if _, ok := m.extensionProxies[p.extension]; !ok {
+			m.extensionProxies[p.extension] = name
+		}
+		if p.extension == "flutter" {
+			for _, call := range toolchains[name] {
+				_, kwargs := callArgs(call)
+				toolchain := kwargs["name"]
+				if toolchain == "" {
+					toolchain = "flutter"
+				}
+				m.toolchainNames = append(m.toolchainNames, toolchain)
+			}
+		}
+		for _, call := range useRepos[name] {
+			repos := m.extensionRepos[p.extension]
+			if repos == nil {
+				repos = make(map[string]string)
+				m.extensionRepos[p.extension] = repos
+			}
+			args, kwargs := callArgs(call)
+			for _, repo := range args {
+				repos[repo] = repo
+			}
+			for apparent, repo := range kwargs {
+				repos[repo] = apparent
+			}
+		}
+	}
+	return m
+}
+
+// isRulesFlutterExtension reports whether bzlFile is rules_flutter's
+// flutter/extensions.bzl, as seen from this module.
+func (m *moduleFile) isRulesFlutterExtension(bzlFile string) bool {
+	l, err := label.Parse(bzlFile)
+	if err != nil || l.Pkg != "flutter" || l.Name != "extensions.bzl" {
+		return false
+	}
+	// A repository-relative label means this module is rules_flutter itself.
+	return l.Repo == "" || l.Repo == m.rulesFlutterName()
+}
+
+// rulesFlutterName returns the apparent name of rules_flutter.
+func (m *moduleFile) rulesFlutterName() string {
+	if name, ok := m.apparentNames[rulesFlutterModule]; ok {
+		return name
+	}
+	return rulesFlutterModule
+}
+
+// sdkRepo returns the apparent name under which the module imports the
+// Flutter SDK repository ("<toolchain name>_sdk") from the flutter
+// extension, or "" if it doesn't.
+func (m *moduleFile) sdkRepo() string {
+	repos := m.extensionRepos["flutter"]
+	for _, toolchain := range append(m.toolchainNames, "flutter") {
+		if apparent, ok := repos[toolchain+"_sdk"]; ok {
+			return apparent
+		}
+	}
+	return ""
+}
+
+// pathRepos maps each local_path_override directory, relative to the
+// repository root, to the apparent name of the module it provides.
+func (m *moduleFile) pathRepos() map[string]string {
+	repos := make(map[string]string)
+	for name, dir := range m.localPaths {
+		apparent, ok := m.apparentNames[name]
+		if !ok {
+			continue
+		}
+		repos[path.Clean(filepath.ToSlash(dir))] = "@" + apparent
+	}
+	return repos
+}
+
+// callName returns the name of the function called by call, or "" for calls
+// of anything but a plain identifier.
+func callName(call *bzl.CallExpr) string {
+	if id, ok := call.X.(*bzl.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// callArgs returns the string literal positional and keyword arguments of
+// call. Other arguments are skipped.
+func callArgs(call *bzl.CallExpr) (args []string, kwargs map[string]string) {
+	kwargs = make(map[string]string)
+	for _, arg := range call.List {
+		switch arg := arg.(type) {
+		case *bzl.StringExpr:
+			args = append(args, arg.Value)
+		case *bzl.AssignExpr:
+			key, ok := arg.LHS.(*bzl.Ident)
+			value, isString := arg.RHS.(*bzl.StringExpr)
+			if ok && isString {
+				kwargs[key.Name] = value.Value
+			}
+		}
+	}
+	return args, kwargs
+}
@@ -0,0 +1,85 @@
+package flutter
+
+import (
+	"reflect"
+	"testing"
+
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+func parseTestModule(t *testing.T, content string) *moduleFile {
+	t.Helper()
+	f, err := bzl.ParseModule("MODULE.bazel", []byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseModuleFile(f)
+}
+
+func TestModuleFileSDKRepo(t *testing.T) {
+	for _, tc := range []struct {
+		name, module, want string
+	}{
+		{
+			name: "default",
+			module: `bazel_dep(name = "rules_flutter", version = "0.2.1")
+flutter = use_extension("@rules_flutter//flutter:extensions.bzl", "flutter")
+use_repo(flutter, "flutter_sdk", "flutter_toolchains")
+`,
+			want: "flutter_sdk",
+		},
+		{
+			name: "renamed import",
+			module: `bazel_dep(name = "rules_flutter", version = "0.2.1")
+flutter = use_extension("@rules_flutter//flutter:extensions.bzl", "flutter")
+use_repo(flutter, "flutter_toolchains", my_sdk = "flutter_sdk")
+`,
+			want: "my_sdk",
+		},
+		{
+			name: "renamed rules_flutter and toolchain",
+			module: `bazel_dep(name = "rules_flutter", version = "0.2.1", repo_name = "flutter_rules")
+fl = use_extension(
+    extension_bzl_file = "@flutter_rules//flutter:extensions.bzl",
+    extension_name = "flutter",
+)
+fl.toolchain(name = "stable", flutter_version = "3.24.0")
+use_repo(fl, "stable_sdk")
+`,
+			want: "stable_sdk",
+		},
+		{
+			name: "rules_flutter itself",
+			module: `module(name = "rules_flutter")
+flutter = use_extension("//flutter:extensions.bzl", "flutter")
+use_repo(flutter, "flutter_sdk")
+`,
+			want: "flutter_sdk",
+		},
+		{
+			name: "other extension",
+			module: `other = use_extension("@other//flutter:extensions.bzl", "flutter")
+use_repo(other, sdk = "flutter_sdk")
+`,
+			want: "",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := parseTestModule(t, tc.module).sdkRepo(); got != tc.want {
+				t.Fatalf("sdkRepo() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestModuleFileExtensionRepos(t *testing.T) {
+	m := parseTestModule(t, `bazel_dep(name = "rules_flutter", version = "0.2.1")
+pub = use_extension("@rules_flutter//flutter:extensions.bzl", "pub")
+use_repo(pub, "pub_http")
+use_repo(pub, "pub_collection", path = "pub_path")
+`)
+	want := map[string]string{"pub_http": "pub_http", "pub_collection": "pub_collection", "pub_path": "path"}
+	if got := m.extensionRepos["pub"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pub repos: want %v got %v", want, got)
+	}
+}
@@ -3,6 +3,7 @@ package flutter
 import (
 	"encoding/json"
 	"os"
+	"sort"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -15,18 +16,29 @@ type PubDeps struct {
 
 // PubDepsPackage represents a single package entry in pub_deps.json.
 type PubDepsPackage struct {
-	Name        string      `json:"name"`
-	Dependency  string      `json:"dependency"`
+	Name       string `json:"name"`
+	Dependency string `json:"dependency"`
+	// Kind is how current `flutter pub deps --json` output classifies the
+	// package ("root", "direct", "dev" or "transitive") in place of
+	// Dependency. ParsePubDeps translates it into Dependency.
+	Kind        string      `json:"kind"`
 	Description interface{} `json:"description"`
 	Source      string      `json:"source"`
 	Version     string      `json:"version"`
 }
 
+// defaultHostedURL is the pub server used by hosted dependencies that don't
+// name one.
+const defaultHostedURL = "https://pub.dev"
+
 // PubspecYaml represents the structure of a pubspec.yaml file
 type PubspecYaml struct {
-	Name         string                 `yaml:"name"`
-	Dependencies map[string]interface{} `yaml:"dependencies"`
-	Environment  map[string]interface{} `yaml:"environment"`
+	Name                string                 `yaml:"name"`
+	Dependencies        map[string]interface{} `yaml:"dependencies"`
+	DevDependencies     map[string]interface{} `yaml:"dev_dependencies"`
+	DependencyOverrides map[string]interface{} `yaml:"dependency_overrides"`
+	Environment         map[string]interface{} `yaml:"environment"`
+	Flutter             *PubspecFlutter        `yaml:"flutter"`
 }
 
 // ParsePubDeps parses a pub_deps.json file and returns the parsed structure
@@ -40,10 +52,24 @@ func ParsePubDeps(path string) (*PubDeps, error) {
 	if err := json.Unmarshal(data, &deps); err != nil {
 		return nil, err
 	}
+	for i, pkg := range deps.Packages {
+		if pkg.Dependency == "" {
+			deps.Packages[i].Dependency = pubDepsKinds[pkg.Kind]
+		}
+	}
 
 	return &deps, nil
 }
 
+// pubDepsKinds maps the "kind" of a package in current pub deps output to
+// the "dependency" older versions report.
+var pubDepsKinds = map[string]string{
+	"root":       "root",
+	"direct":     "direct main",
+	"dev":        "direct dev",
+	"transitive": "transitive",
+}
+
 // ParsePubspecYaml parses a pubspec.yaml file and returns the parsed structure
 func ParsePubspecYaml(path string) (*PubspecYaml, error) {
 	data, err := os.ReadFile(path)
@@ -84,11 +110,155 @@ func GetDirectDependencies(depsFile *PubDeps) map[string]PubDepsPackage {
 	return deps
 }
 
+// PubDepsFromPubspec derives the direct dependencies of a package from its
+// pubspec.yaml, in the shape `flutter pub deps --json` reports them. It is
+// the fallback for packages without a usable pub_deps.json.
+//
+// Hosted (`foo: ^1.0`, `hosted:`), `sdk:`, `path:` and `git:` forms are
+// recognized. dependency_overrides replace the source of a direct dependency
+// but keep its main or dev kind, so an overridden dev dependency still stays
+// off the production library; overrides of transitive packages are not
+// direct dependencies and are ignored.
+func PubDepsFromPubspec(pubspec *PubspecYaml) *PubDeps {
+	if pubspec == nil {
+		return nil
+	}
+
+	entries := make(map[string]PubDepsPackage)
+	for name, spec := range pubspec.Dependencies {
+		entries[name] = pubspecDependency(name, "direct main", spec)
+	}
+	for name, spec := range pubspec.DevDependencies {
+		if _, ok := entries[name]; !ok {
+			entries[name] = pubspecDependency(name, "direct dev", spec)
+		}
+	}
+	for name, spec := range pubspec.DependencyOverrides {
+		if dep, ok := entries[name]; ok {
+			entries[name] = pubspecDependency(name, dep.Dependency, spec)
+		}
+	}
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	deps := &PubDeps{}
+	for _, name := range names {
+		deps.Packages = append(deps.Packages, entries[name])
+	}
+	return deps
+}
+
+// pubspecDependency converts one pubspec.yaml dependency entry.
+func pubspecDependency(name, kind string, spec interface{}) PubDepsPackage {
+	pkg := PubDepsPackage{
+		Name:       name,
+		Dependency: kind,
+		Source:     "hosted",
+		Description: map[string]interface{}{
+			"name": name,
+			"url":  defaultHostedURL,
+		},
+	}
+
+	fields, ok := spec.(map[string]interface{})
+	if !ok {
+		// `foo: ^1.0`, `foo: any` or `foo:`
+		if version, ok := spec.(string); ok {
+			pkg.Version = version
+		}
+		return pkg
+	}
+
+	if version, ok := fields["version"].(string); ok {
+		pkg.Version = version
+	}
+
+	switch {
+	case fields["sdk"] != nil:
+		pkg.Source = "sdk"
+		pkg.Description = fields["sdk"]
+	case fields["path"] != nil:
+		pkg.Source = "path"
+		pkg.Description = map[string]interface{}{
+			"path":     fields["path"],
+			"relative": true,
+		}
+	case fields["git"] != nil:
+		pkg.Source = "git"
+		desc := map[string]interface{}{}
+		switch git := fields["git"].(type) {
+		case string:
+			desc["url"] = git
+		case map[string]interface{}:
+			for _, key := range []string{"url", "ref", "path"} {
+				if value, ok := git[key]; ok {
+					desc[key] = value
+				}
+			}
+		}
+		pkg.Description = desc
+	case fields["hosted"] != nil:
+		desc := map[string]interface{}{"name": name}
+		switch hosted := fields["hosted"].(type) {
+		case string:
+			desc["url"] = hosted
+		case map[string]interface{}:
+			if hostedName, ok := hosted["name"].(string); ok {
+				desc["name"] = hostedName
+			}
+			desc["url"] = hosted["url"]
+		}
+		pkg.Description = desc
+	}
+
+	return pkg
+}
+
+// HostedURL returns the pub server a hosted package comes from, normalized
+// without a trailing slash. It defaults to pub.dev when the description
+// doesn't name one.
+func HostedURL(pkg PubDepsPackage) string {
+	url := ""
+	switch desc := pkg.Description.(type) {
+	case string:
+		url = desc
+	case map[string]interface{}:
+		for _, key := range []string{"url", "base_url", "hosted_url", "hosted-url"} {
+			if value, ok := desc[key].(string); ok && value != "" {
+				url = value
+				break
+			}
+		}
+	}
+	return normalizeHostedURL(url)
+}
+
+// normalizeHostedURL trims trailing slashes and maps "" to pub.dev.
+func normalizeHostedURL(url string) string {
+	url = strings.TrimRight(url, "/")
+	if url == "" {
+		return defaultHostedURL
+	}
+	return url
+}
+
+// defaultRepoPrefix is the prefix the pub extension gives package repositories.
+const defaultRepoPrefix = "pub_"
+
 // SanitizeRepoName converts a package name to a valid Bazel repository name
 // Matches the logic in flutter/extensions.bzl:_sanitize_repo_name
 func SanitizeRepoName(pkg string) string {
+	return PrefixedRepoName(defaultRepoPrefix, pkg)
+}
+
+// PrefixedRepoName is SanitizeRepoName with a custom repository prefix.
+func PrefixedRepoName(prefix, pkg string) string {
 	var result strings.Builder
-	result.WriteString("pub_")
+	result.WriteString(prefix)
 
 	for _, ch := range pkg {
 		if (ch >= 'a' && ch <= 'z') ||
@@ -0,0 +1,82 @@
+package flutter
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPubDepsFromPubspec(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml": `name: example
+dependencies:
+  flutter:
+    sdk: flutter
+  collection: ^1.18.0
+  any_version:
+  models:
+    path: ../models
+  forked:
+    git:
+      url: https://github.com/example/forked.git
+      ref: v2
+      path: packages/forked
+  simple_git:
+    git: https://github.com/example/simple.git
+  internal:
+    hosted: https://pub.corp.example
+    version: ^2.0.0
+  overridden: ^1.0.0
+dev_dependencies:
+  flutter_test:
+    sdk: flutter
+  collection: ^1.17.0
+  mocktail: ^1.0.0
+dependency_overrides:
+  overridden:
+    path: ../overridden
+  mocktail:
+    path: ../mocktail
+  transitive_only: 1.0.0
+`,
+	})
+
+	pubspec, err := ParsePubspecYaml(filepath.Join(dir, "pubspec.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]PubDepsPackage{}
+	for _, pkg := range PubDepsFromPubspec(pubspec).Packages {
+		got[pkg.Name] = pkg
+	}
+
+	want := map[string]PubDepsPackage{
+		"any_version": {Name: "any_version", Dependency: "direct main", Source: "hosted",
+			Description: map[string]interface{}{"name": "any_version", "url": "https://pub.dev"}},
+		"collection": {Name: "collection", Dependency: "direct main", Source: "hosted", Version: "^1.18.0",
+			Description: map[string]interface{}{"name": "collection", "url": "https://pub.dev"}},
+		"flutter":      {Name: "flutter", Dependency: "direct main", Source: "sdk", Description: "flutter"},
+		"flutter_test": {Name: "flutter_test", Dependency: "direct dev", Source: "sdk", Description: "flutter"},
+		"forked": {Name: "forked", Dependency: "direct main", Source: "git",
+			Description: map[string]interface{}{
+				"url":  "https://github.com/example/forked.git",
+				"ref":  "v2",
+				"path": "packages/forked",
+			}},
+		"internal": {Name: "internal", Dependency: "direct main", Source: "hosted", Version: "^2.0.0",
+			Description: map[string]interface{}{"name": "internal", "url": "https://pub.corp.example"}},
+		"models": {Name: "models", Dependency: "direct main", Source: "path",
+			Description: map[string]interface{}{"path": "../models", "relative": true}},
+		"mocktail": {Name: "mocktail", Dependency: "direct dev", Source: "path",
+			Description: map[string]interface{}{"path": "../mocktail", "relative": true}},
+		"overridden": {Name: "overridden", Dependency: "direct main", Source: "path",
+			Description: map[string]interface{}{"path": "../overridden", "relative": true}},
+		"simple_git": {Name: "simple_git", Dependency: "direct main", Source: "git",
+			Description: map[string]interface{}{"url": "https://github.com/example/simple.git"}},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("PubDepsFromPubspec:\nwant %+v\n got %+v", want, got)
+	}
+}
@@ -1,10 +1,15 @@
 package flutter
 
 import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
 	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 )
 
@@ -13,11 +18,18 @@ func (fl *flutterLang) Kinds() map[string]rule.KindInfo {
 	return map[string]rule.KindInfo{
 		"flutter_library": {
 			MatchAny: false,
+			// pubspec isn't mergeable, so a library counts as empty once
+			// the merge has removed what Gazelle generated.
 			NonEmptyAttrs: map[string]bool{
-				"pubspec": true,
+				"data": true,
+				"deps": true,
+				"srcs": true,
 			},
 			MergeableAttrs: map[string]bool{
-				"deps": true,
+				"data":               true,
+				"deps":               true,
+				"generator_commands": true,
+				"srcs":               true,
 			},
 			ResolveAttrs: map[string]bool{
 				"deps": true,
@@ -25,11 +37,23 @@ func (fl *flutterLang) Kinds() map[string]rule.KindInfo {
 		},
 		"flutter_app": {
 			MatchAny: false,
+			// embed isn't mergeable, so an app counts as empty once the
+			// merge has removed its platforms.
 			NonEmptyAttrs: map[string]bool{
-				"embed": true,
+				"web":     true,
+				"apk":     true,
+				"ios":     true,
+				"macos":   true,
+				"linux":   true,
+				"windows": true,
 			},
 			MergeableAttrs: map[string]bool{
-				"srcs": true,
+				"web":     true,
+				"apk":     true,
+				"ios":     true,
+				"macos":   true,
+				"linux":   true,
+				"windows": true,
 			},
 			ResolveAttrs: map[string]bool{
 				"embed": true,
@@ -41,19 +65,52 @@ func (fl *flutterLang) Kinds() map[string]rule.KindInfo {
 				"embed": true,
 			},
 			MergeableAttrs: map[string]bool{
-				"srcs": true,
+				"embed":      true,
+				"srcs":       true,
+				"test_files": true,
 			},
 			ResolveAttrs: map[string]bool{
 				"embed": true,
 			},
 		},
-		"dart_library": {
+		"flutter_analyze_test": {
+			MatchAny: false,
+			NonEmptyAttrs: map[string]bool{
+				"embed": true,
+			},
+			MergeableAttrs: map[string]bool{
+				"embed":          true,
+				"fatal_infos":    true,
+				"fatal_warnings": true,
+				"srcs":           true,
+			},
+			ResolveAttrs: map[string]bool{
+				"embed": true,
+			},
+		},
+		"dart_format_test": {
 			MatchAny: false,
 			NonEmptyAttrs: map[string]bool{
 				"srcs": true,
 			},
 			MergeableAttrs: map[string]bool{
+				"srcs": true,
+			},
+		},
+		"dart_library": {
+			MatchAny: false,
+			// pubspec isn't mergeable, so a library counts as empty once
+			// the merge has removed what Gazelle generated.
+			NonEmptyAttrs: map[string]bool{
+				"data": true,
 				"deps": true,
+				"srcs": true,
+			},
+			MergeableAttrs: map[string]bool{
+				"data":               true,
+				"deps":               true,
+				"generator_commands": true,
+				"srcs":               true,
 			},
 			ResolveAttrs: map[string]bool{
 				"deps": true,
@@ -67,39 +124,309 @@ func (fl *flutterLang) Loads() []rule.LoadInfo {
 	return []rule.LoadInfo{
 		{
 			Name:    "@rules_flutter//flutter:defs.bzl",
-			Symbols: []string{"flutter_library", "flutter_app", "flutter_test", "dart_library"},
+			Symbols: []string{"flutter_library", "flutter_app", "flutter_test", "flutter_analyze_test", "dart_format_test", "dart_library"},
 		},
 	}
 }
 
-// resolveFlutterImport resolves a Dart package import to a Bazel label
-func resolveFlutterImport(imp string) (label.Label, bool) {
-	// Parse package: imports
+// pubspecNameKey is the private attribute carrying a generated library's
+// pubspec package name from GenerateRules to Imports.
+const pubspecNameKey = "_pubspec_name"
+
+// devLibraryKey marks generated testonly libraries, which are not indexed:
+// other packages must resolve to the production library.
+const devLibraryKey = "_dev_library"
+
+// resolveInputs is the import payload GenerateRules hands to Resolve for
+// each generated rule.
+type resolveInputs struct {
+	// PackageName is the pubspec name of the package the rule belongs to.
+	PackageName string
+
+	// Packages lists the Dart packages imported by the rule's sources.
+	Packages []string
+
+	// HostedURLs maps hosted dependencies of the package to their pub server.
+	HostedURLs map[string]string
+
+	// PathDeps maps path dependencies of the rule to the label their library
+	// is expected at.
+	PathDeps map[string]label.Label
+
+	// SDKDeps maps SDK dependencies of the package to the SDK providing them.
+	SDKDeps map[string]string
+
+	// GitDeps maps git dependencies of the package to their pub_deps.json
+	// entry.
+	GitDeps map[string]PubDepsPackage
+}
+
+// isLibraryKind reports whether kind is a library rule indexed by its pubspec name.
+func isLibraryKind(kind string) bool {
+	return kind == "flutter_library" || kind == "dart_library"
+}
+
+// pubspecPackageName returns the pubspec name of a library rule, reading the
+// pubspec file for rules that were not generated in this run.
+func pubspecPackageName(r *rule.Rule, f *rule.File) string {
+	if name, ok := r.PrivateAttr(pubspecNameKey).(string); ok && name != "" {
+		return name
+	}
+
+	pubspec := strings.TrimPrefix(r.AttrString("pubspec"), ":")
+	if pubspec == "" || f == nil || f.Path == "" || strings.ContainsAny(pubspec, ":@") {
+		return ""
+	}
+
+	parsed, err := ParsePubspecYaml(filepath.Join(filepath.Dir(f.Path), filepath.FromSlash(pubspec)))
+	if err != nil {
+		return ""
+	}
+	return parsed.Name
+}
+
+// importedPackages returns the sorted set of packages imported by the Dart
+// files among srcs, which are relative to dir.
+func importedPackages(dir string, srcs []string) []string {
+	seen := make(map[string]bool)
+	for _, src := range srcs {
+		if !strings.HasSuffix(src, ".dart") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, src))
+		if err != nil {
+			continue
+		}
+		for _, d := range ParseDartDirectives(string(content)) {
+			if d.Kind != DartImport && d.Kind != DartExport {
+				continue
+			}
+			for _, uri := range d.URIs() {
+				if pkg, ok := packageFromImport(uri); ok {
+					seen[pkg] = true
+				}
+			}
+		}
+	}
+
+	pkgs := make([]string, 0, len(seen))
+	for pkg := range seen {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	return pkgs
+}
+
+// packageFromImport returns the package name of a package: import URI.
+func packageFromImport(imp string) (string, bool) {
 	// Format: package:package_name/path/to/file.dart
 	if !strings.HasPrefix(imp, "package:") {
-		return label.Label{}, false
+		return "", false
+	}
+
+	pkgName, _, _ := strings.Cut(strings.TrimPrefix(imp, "package:"), "/")
+	if pkgName == "" {
+		return "", false
+	}
+	return pkgName, true
+}
+
+// resolvePackages maps imported packages to sorted, de-duplicated dependency labels.
+func resolvePackages(c *config.Config, ix *resolve.RuleIndex, in resolveInputs, from label.Label) []string {
+	fc := GetFlutterConfig(c)
+
+	seen := make(map[string]bool)
+	var deps []string
+	for _, pkg := range in.Packages {
+		if pkg == in.PackageName {
+			continue
+		}
+		dep := resolvePackage(c, ix, fc, pkg, in, from)
+		if dep == "" || seen[dep] {
+			continue
+		}
+		seen[dep] = true
+		deps = append(deps, dep)
+	}
+
+	sort.Strings(deps)
+	return deps
+}
+
+// resolvePackage resolves a Dart package to its flutter_resolve label or an
+// in-repo library first, then to the library in its path dependency
+// directory, the Flutter SDK or the package's git or hosted pub repository.
+func resolvePackage(c *config.Config, ix *resolve.RuleIndex, fc *FlutterConfig, pkg string, in resolveInputs, from label.Label) string {
+	if l, ok := fc.Resolves[pkg]; ok {
+		return formatLabel(l.Rel(from.Repo, from.Pkg))
+	}
+	if l, ok := in.PathDeps[pkg]; ok && l.Repo != "" {
+		// Libraries in other modules are never in this repository's index.
+		return formatLabel(l.Rel(from.Repo, from.Pkg))
+	}
+
+	spec := resolve.ImportSpec{Lang: languageName, Imp: pkg}
+	if l, ok := resolve.FindRuleWithOverride(c, spec, languageName); ok {
+		return formatLabel(l.Rel(from.Repo, from.Pkg))
+	}
+
+	if ix != nil {
+		var matches []label.Label
+		for _, m := range ix.FindRulesByImportWithConfig(c, spec, languageName) {
+			if !m.IsSelfImport(from) {
+				matches = append(matches, m.Label)
+			}
+		}
+		if len(matches) > 1 {
+			log.Printf("%s: package %q is provided by multiple rules (%s and %s); using the first", from, pkg, matches[0], matches[1])
+		}
+		if len(matches) > 0 {
+			return formatLabel(matches[0].Rel(from.Repo, from.Pkg))
+		}
+	}
+
+	if l, ok := in.PathDeps[pkg]; ok {
+		log.Printf("%s: no library with pubspec name %q is indexed for path dependency //%s; assuming %s", from, pkg, l.Pkg, l)
+		return formatLabel(l.Rel(from.Repo, from.Pkg))
+	}
+	if l, ok := sdkDependencyLabel(pkg, fc); ok {
+		return l
+	}
+	if sdk, ok := in.SDKDeps[pkg]; ok {
+		logUnknownSDKPackage(from.String(), pkg, sdk)
+		return ""
+	}
+	if meta, ok := in.GitDeps[pkg]; ok {
+		return gitDependencyLabel(meta, fc, from.Pkg)
 	}
+	return hostedDependencyLabel(pkg, in.HostedURLs[pkg], fc)
+}
+
+// hostedDependencyLabel returns the label of a hosted package's repository.
+// Packages from a server mapped by flutter_hosted_repo live in a repository
+// with that prefix, or in the mapped hub repository; everything else uses the
+// pub extension's naming, under the apparent name the root module imports the
+// repository as.
+func hostedDependencyLabel(pkg, hostedURL string, fc *FlutterConfig) string {
+	repo := fc.HostedRepos[normalizeHostedURL(hostedURL)]
+	switch {
+	case repo == "":
+		return pubRepoLabel(fc.pubRepos.apparentName(SanitizeRepoName(pkg)), pkg)
+	case strings.HasSuffix(repo, "_"):
+		return pubRepoLabel(PrefixedRepoName(strings.TrimPrefix(repo, "@"), pkg), pkg)
+	default:
+		return formatLabel(label.New(strings.TrimPrefix(repo, "@"), pkg, pkg))
+	}
+}
+
+// pubRepoLabel returns the label of package pkg in its own repository.
+func pubRepoLabel(repo, pkg string) string {
+	return formatLabel(label.New(repo, "", pkg))
+}
 
-	// Extract package name
-	imp = strings.TrimPrefix(imp, "package:")
-	parts := strings.SplitN(imp, "/", 2)
-	if len(parts) == 0 {
-		return label.Label{}, false
+// formatLabel renders l in the short form buildifier writes: "//a/b:b" as
+// "//a/b" and "@x//:x" as "@x".
+func formatLabel(l label.Label) string {
+	if !l.Relative && l.Repo != "" && l.Repo != "@" && l.Pkg == "" && l.Name == l.Repo {
+		return "@" + l.Repo
 	}
+	return l.String()
+}
 
-	pkgName := parts[0]
+// localLabel returns the label of target name in the same package.
+func localLabel(name string) string {
+	return label.Label{Name: name, Relative: true}.String()
+}
 
-	// Map to repository label
-	repoName := SanitizeRepoName(pkgName)
-	return label.New(repoName, "", pkgName), true
+// canonicalLabel returns the absolute label s in the form formatLabel
+// renders it, so long and short spellings of the same label compare equal.
+// Relative labels, strings that don't parse and canonical "@@repo" labels
+// are returned unchanged.
+func canonicalLabel(s string) string {
+	if strings.HasPrefix(s, "@@") || !strings.HasPrefix(s, "@") && !strings.HasPrefix(s, "//") {
+		return s
+	}
+	l, err := label.Parse(s)
+	if err != nil {
+		return s
+	}
+	return formatLabel(l)
 }
 
-// Fix is not implemented for Flutter
-func (fl *flutterLang) Fix(c *config.Config, f *rule.File) {
-	// No automatic fixes needed
+// mergeLabels returns the sorted union of two label lists in canonical form.
+func mergeLabels(a, b []string) []string {
+	var out []string
+	for _, list := range [][]string{a, b} {
+		for _, v := range list {
+			out = append(out, canonicalLabel(v))
+		}
+	}
+	return unionSorted(out, nil)
 }
 
-// ApparentLoads returns the load statements that are visible in the BUILD file
+// hostedURLs returns the pub server of every direct hosted dependency in deps
+// that doesn't come from pub.dev. Servers no flutter_hosted_repo directive
+// maps are reported, since the pub extension only fetches from pub.dev.
+func hostedURLs(deps *PubDeps, fc *FlutterConfig, rel string) map[string]string {
+	if deps == nil {
+		return nil
+	}
+	var urls map[string]string
+	for _, pkg := range deps.Packages {
+		if pkg.Source != "hosted" || !strings.HasPrefix(pkg.Dependency, "direct") {
+			continue
+		}
+		url := HostedURL(pkg)
+		if url == defaultHostedURL {
+			continue
+		}
+		if _, ok := fc.HostedRepos[url]; !ok {
+			log.Printf("//%s: %s is hosted on %s, which no %s directive maps; assuming @%s", rel, pkg.Name, url, DirectiveHostedRepo, SanitizeRepoName(pkg.Name))
+		}
+		if urls == nil {
+			urls = make(map[string]string)
+		}
+		urls[pkg.Name] = url
+	}
+	return urls
+}
+
+// gitDeps returns the direct git dependencies in deps by package name.
+func gitDeps(deps *PubDeps) map[string]PubDepsPackage {
+	if deps == nil {
+		return nil
+	}
+	var git map[string]PubDepsPackage
+	for _, pkg := range deps.Packages {
+		if pkg.Source != "git" || !strings.HasPrefix(pkg.Dependency, "direct") {
+			continue
+		}
+		if git == nil {
+			git = make(map[string]PubDepsPackage)
+		}
+		git[pkg.Name] = pkg
+	}
+	return git
+}
+
+// ApparentLoads returns the load statements that are visible in the BUILD file,
+// naming rules_flutter by its apparent name in the root module
 func (fl *flutterLang) ApparentLoads(moduleToApparentName func(string) string) []rule.LoadInfo {
-	return fl.Loads()
+	loads := fl.Loads()
+	for i := range loads {
+		loads[i].Name = ApparentDefsBzl(moduleToApparentName)
+	}
+	return loads
+}
+
+// ApparentDefsBzl returns the label of rules_flutter's defs.bzl under the
+// apparent name moduleToApparentName gives rules_flutter.
+func ApparentDefsBzl(moduleToApparentName func(string) string) string {
+	repo := rulesFlutterModule
+	if moduleToApparentName != nil {
+		if name := moduleToApparentName(rulesFlutterModule); name != "" {
+			repo = name
+		}
+	}
+	return "@" + repo + "//flutter:defs.bzl"
 }
@@ -0,0 +1,338 @@
+package flutter
+
+import (
+	"flag"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestImportedPackagesFromSources(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"lib/main.dart": `import 'package:flutter/material.dart';
+import "package:models/models.dart";
+import 'dart:async';
+import 'src/util.dart';
+`,
+		"lib/src/util.dart": "import 'package:collection/collection.dart';\n",
+		"lib/data.json":     "import 'package:ignored/ignored.dart';\n",
+	})
+
+	got := importedPackages(dir, []string{"lib/data.json", "lib/main.dart", "lib/src/util.dart"})
+	want := []string{"collection", "flutter", "models"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("importedPackages: want %v got %v", want, got)
+	}
+}
+
+func TestResolveImportsPrefersInRepoLibraries(t *testing.T) {
+	fl := &flutterLang{}
+	c := resolveTestConfig(t)
+	GetFlutterConfig(c).DepsMode = DepsModeImports
+
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return fl })
+	models := rule.NewRule("dart_library", "lib")
+	models.SetPrivateAttr(pubspecNameKey, "models")
+	ix.AddRule(c, models, rule.EmptyFile("packages/models/BUILD.bazel", "packages/models"))
+
+	app := rule.NewRule("flutter_library", "lib")
+	app.SetPrivateAttr(pubspecNameKey, "app")
+	ix.AddRule(c, app, rule.EmptyFile("apps/app/BUILD.bazel", "apps/app"))
+	ix.Finish()
+
+	in := resolveInputs{
+		PackageName: "app",
+		Packages:    []string{"app", "collection", "flutter", "models"},
+	}
+	fl.Resolve(c, ix, nil, app, in, label.New("", "apps/app", "lib"))
+
+	want := []string{
+		"//packages/models:lib",
+		"@flutter_sdk//flutter/packages/flutter",
+		"@pub_collection//:collection",
+	}
+	if got := app.AttrStrings("deps"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("resolved deps: want %v got %v", want, got)
+	}
+}
+
+func TestResolveKeepsPubDepsInDefaultMode(t *testing.T) {
+	fl := &flutterLang{}
+	c := resolveTestConfig(t)
+
+	r := rule.NewRule("flutter_library", "lib")
+	r.SetAttr("deps", []string{"@pub_collection//:collection"})
+	fl.Resolve(c, nil, nil, r, resolveInputs{Packages: []string{"models"}}, label.New("", "app", "lib"))
+
+	if got := r.AttrStrings("deps"); !reflect.DeepEqual(got, []string{"@pub_collection//:collection"}) {
+		t.Fatalf("pub_deps mode deps were rewritten: %v", got)
+	}
+}
+
+func TestImportsIndexesLibrariesByPubspecName(t *testing.T) {
+	dir := writePackage(t, map[string]string{"pubspec.yaml": "name: hand_written\n"})
+	f, err := rule.LoadData(filepath.Join(dir, "BUILD.bazel"), "", []byte(`
+dart_library(
+    name = "lib",
+    pubspec = "pubspec.yaml",
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := (&flutterLang{}).Imports(resolveTestConfig(t), f.Rules[0], f)
+	want := []resolve.ImportSpec{{Lang: languageName, Imp: "hand_written"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Imports: want %v got %v", want, got)
+	}
+}
+
+func TestImportsSkipsTestonlyLibrariesFromBuildFiles(t *testing.T) {
+	dir := writePackage(t, map[string]string{"pubspec.yaml": "name: models\n"})
+	f, err := rule.LoadData(filepath.Join(dir, "BUILD.bazel"), "models", []byte(`
+flutter_library(
+    name = "lib",
+    pubspec = "pubspec.yaml",
+)
+
+flutter_library(
+    name = "lib_dev",
+    pubspec = "pubspec.yaml",
+    testonly = True,
+)
+
+flutter_library(
+    name = "fakes",
+    pubspec = "pubspec.yaml",
+    testonly = True,
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fl := &flutterLang{}
+	c := resolveTestConfig(t)
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return fl })
+	for _, r := range f.Rules {
+		ix.AddRule(c, r, f)
+	}
+	ix.Finish()
+
+	var got []string
+	for _, m := range ix.FindRulesByImportWithConfig(c, resolve.ImportSpec{Lang: languageName, Imp: "models"}, languageName) {
+		got = append(got, m.Label.String())
+	}
+	if want := []string{"//models:lib"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("rules indexed for models: want %v got %v", want, got)
+	}
+}
+
+func TestResolveImportsUsesHostedRepoMappings(t *testing.T) {
+	fl := &flutterLang{}
+	c := resolveTestConfig(t)
+	fc := GetFlutterConfig(c)
+	fc.DepsMode = DepsModeImports
+	fc.HostedRepos = map[string]string{
+		"https://pub.corp.example": "@corp_pub_",
+		"https://hub.corp.example": "@corp_hub",
+	}
+
+	r := rule.NewRule("flutter_library", "lib")
+	in := resolveInputs{
+		Packages: []string{"auth", "collection", "design_system"},
+		HostedURLs: map[string]string{
+			"auth":          "https://pub.corp.example",
+			"design_system": "https://hub.corp.example",
+		},
+	}
+	fl.Resolve(c, nil, nil, r, in, label.New("", "app", "lib"))
+
+	want := []string{
+		"@corp_hub//design_system",
+		"@corp_pub_auth//:auth",
+		"@pub_collection//:collection",
+	}
+	if got := r.AttrStrings("deps"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("resolved deps: want %v got %v", want, got)
+	}
+}
+
+func TestResolveImportsMapsSDKPackages(t *testing.T) {
+	fl := &flutterLang{}
+	c := resolveTestConfig(t)
+	fc := GetFlutterConfig(c)
+	fc.DepsMode = DepsModeImports
+
+	r := rule.NewRule("flutter_library", "lib")
+	in := resolveInputs{
+		Packages: []string{"flutter", "flutter_gpu", "flutter_localizations"},
+		SDKDeps:  map[string]string{"flutter": "flutter", "flutter_gpu": "flutter", "flutter_localizations": "flutter"},
+	}
+	fl.Resolve(c, nil, nil, r, in, label.New("", "app", "lib"))
+
+	// flutter_gpu is declared as an SDK package but has no mapping, so it
+	// must not fall back to a pub repository.
+	want := []string{
+		"@flutter_sdk//flutter/packages/flutter",
+		"@flutter_sdk//flutter/packages/flutter_localizations",
+	}
+	if got := r.AttrStrings("deps"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("resolved deps: want %v got %v", want, got)
+	}
+}
+
+func TestResolveImportsMapsGitPackages(t *testing.T) {
+	fl := &flutterLang{}
+	c := resolveTestConfig(t)
+	fc := GetFlutterConfig(c)
+	fc.DepsMode = DepsModeImports
+	tracker := newTestTracker(t, useRepoTestModule)
+	fc.pubRepos = tracker
+
+	r := rule.NewRule("flutter_library", "lib")
+	in := resolveInputs{
+		Packages: []string{"forked_widgets"},
+		GitDeps: map[string]PubDepsPackage{
+			"forked_widgets": {Name: "forked_widgets", Source: "git", Dependency: "direct main", Description: map[string]interface{}{"url": "https://github.com/example/widgets.git"}},
+		},
+	}
+	fl.Resolve(c, nil, nil, r, in, label.New("", "app", "lib"))
+
+	if got, want := r.AttrStrings("deps"), []string{"@pub_forked_widgets//:forked_widgets"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("resolved deps: want %v got %v", want, got)
+	}
+	if got := tracker.missingRepos(); len(got) != 0 {
+		t.Fatalf("git repositories recorded as missing from use_repo: %v", got)
+	}
+	if _, ok := tracker.missingGit["pub_forked_widgets"]; !ok {
+		t.Fatalf("expected pub_forked_widgets to be reported as an undeclared git repository")
+	}
+}
+
+func TestResolveImportsHonorsResolveDirective(t *testing.T) {
+	fl := &flutterLang{}
+	c := resolveTestConfig(t)
+	fc := GetFlutterConfig(c)
+	fc.DepsMode = DepsModeImports
+	fc.Resolves = map[string]label.Label{"foo": label.New("", "third_party/dart/foo", "lib")}
+
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return fl })
+	vendored := rule.NewRule("dart_library", "lib")
+	vendored.SetPrivateAttr(pubspecNameKey, "foo")
+	ix.AddRule(c, vendored, rule.EmptyFile("vendor/foo/BUILD.bazel", "vendor/foo"))
+	ix.Finish()
+
+	r := rule.NewRule("flutter_library", "lib")
+	fl.Resolve(c, ix, nil, r, resolveInputs{Packages: []string{"foo"}}, label.New("", "app", "lib"))
+
+	if got, want := r.AttrStrings("deps"), []string{"//third_party/dart/foo:lib"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("resolved deps: want %v got %v", want, got)
+	}
+}
+
+func TestResolvePathDependenciesThroughIndex(t *testing.T) {
+	fl := &flutterLang{}
+	c := resolveTestConfig(t)
+
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return fl })
+	models := rule.NewRule("dart_library", "models_lib")
+	models.SetPrivateAttr(pubspecNameKey, "models")
+	ix.AddRule(c, models, rule.EmptyFile("packages/models/BUILD.bazel", "packages/models"))
+	ix.Finish()
+
+	r := rule.NewRule("flutter_library", "lib")
+	r.SetAttr("deps", []string{"@pub_collection//:collection"})
+	in := resolveInputs{
+		PackageName: "app",
+		PathDeps: map[string]label.Label{
+			"models":    label.New("", "packages/models", "lib"),
+			"unindexed": label.New("", "packages/unindexed", "lib"),
+			"shared":    label.New("shared", "models", "lib"),
+		},
+	}
+	fl.Resolve(c, ix, nil, r, in, label.New("", "apps/app", "lib"))
+
+	want := []string{
+		"//packages/models:models_lib",
+		"//packages/unindexed:lib",
+		"@pub_collection//:collection",
+		"@shared//models:lib",
+	}
+	if got := r.AttrStrings("deps"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("resolved deps: want %v got %v", want, got)
+	}
+}
+
+func TestCanonicalLabelUsesShortForms(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"@flutter_sdk//flutter/packages/flutter:flutter", "@flutter_sdk//flutter/packages/flutter"},
+		{"@flutter_sdk//flutter/packages/flutter", "@flutter_sdk//flutter/packages/flutter"},
+		{"@pub_http//:http", "@pub_http//:http"},
+		{"@corp_pub//:corp_pub", "@corp_pub"},
+		{"//packages/models:lib", "//packages/models:lib"},
+		{"//packages/models:models", "//packages/models"},
+		{":lib", ":lib"},
+		{"@@rules_flutter++flutter+flutter_sdk//flutter/packages/flutter:flutter", "@@rules_flutter++flutter+flutter_sdk//flutter/packages/flutter:flutter"},
+		{"not a label", "not a label"},
+	} {
+		if got := canonicalLabel(tc.in); got != tc.want {
+			t.Errorf("canonicalLabel(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestResolvePathDependenciesMergesLongAndShortLabels(t *testing.T) {
+	fl := &flutterLang{}
+	c := resolveTestConfig(t)
+	fc := GetFlutterConfig(c)
+	fc.Resolves = map[string]label.Label{"flutter": label.New("flutter_sdk", "flutter/packages/flutter", "flutter")}
+
+	r := rule.NewRule("flutter_library", "lib")
+	r.SetAttr("deps", []string{"@flutter_sdk//flutter/packages/flutter:flutter"})
+	in := resolveInputs{
+		PathDeps: map[string]label.Label{
+			"flutter": label.New("", "packages/flutter", "lib"),
+			"models":  label.New("", "packages/models", "models"),
+		},
+	}
+	fl.Resolve(c, nil, nil, r, in, label.New("", "apps/app", "lib"))
+
+	want := []string{"//packages/models", "@flutter_sdk//flutter/packages/flutter"}
+	if got := r.AttrStrings("deps"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("resolved deps: want %v got %v", want, got)
+	}
+}
+
+func TestApparentLoadsUseRulesFlutterApparentName(t *testing.T) {
+	loads := (&flutterLang{}).ApparentLoads(func(module string) string {
+		if module == "rules_flutter" {
+			return "flutter_rules"
+		}
+		return ""
+	})
+	if len(loads) != 1 || loads[0].Name != "@flutter_rules//flutter:defs.bzl" {
+		t.Fatalf("ApparentLoads: %v", loads)
+	}
+
+	loads = (&flutterLang{}).ApparentLoads(func(string) string { return "" })
+	if loads[0].Name != "@rules_flutter//flutter:defs.bzl" {
+		t.Fatalf("ApparentLoads without a mapping: %v", loads)
+	}
+}
+
+// resolveTestConfig returns a config with the flutter and resolve extensions registered.
+func resolveTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	c := config.New()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	(&resolve.Configurer{}).RegisterFlags(fs, "update", c)
+	(&flutterLang{}).RegisterFlags(fs, "update", c)
+	return c
+}
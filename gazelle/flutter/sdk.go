@@ -0,0 +1,82 @@
+package flutter
+
+import (
+	"log"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+// defaultSDKPackages maps the packages shipped with the Flutter SDK, and the
+// Dart SDK it bundles, to their directories in the SDK repository. Packages
+// mapped to "" are resolved from the SDK at build time and never appear in
+// deps. flutter_sdk_package directives extend and override the table.
+var defaultSDKPackages = map[string]string{
+	"flutter":               "flutter/packages/flutter",
+	"flutter_driver":        "flutter/packages/flutter_driver",
+	"flutter_localizations": "flutter/packages/flutter_localizations",
+	"flutter_test":          "flutter/packages/flutter_test",
+	"flutter_web_plugins":   "flutter/packages/flutter_web_plugins",
+	"integration_test":      "flutter/packages/integration_test",
+	"sky_engine":            "flutter/bin/cache/pkg/sky_engine",
+
+	// Dart SDK internals, found by pub under dart-sdk/pkg.
+	"_macros": "",
+}
+
+// sdkPackagePath returns the SDK repository directory of an SDK package, and
+// whether the package is known at all.
+func (fc *FlutterConfig) sdkPackagePath(pkg string) (string, bool) {
+	if path, ok := fc.SDKPackages[pkg]; ok {
+		return path, true
+	}
+	path, ok := defaultSDKPackages[pkg]
+	return path, ok
+}
+
+// sdkDependencyLabel returns the Bazel label for an SDK provided package, or
+// "" for packages that need no dep. ok is false for packages neither the
+// built-in table nor a flutter_sdk_package directive maps.
+func sdkDependencyLabel(pkg string, fc *FlutterConfig) (string, bool) {
+	path, ok := fc.sdkPackagePath(pkg)
+	if !ok {
+		return "", false
+	}
+	if path == "" || fc.SDKRepo == "" {
+		return "", true
+	}
+	return formatLabel(label.New(strings.TrimPrefix(fc.SDKRepo, "@"), path, pkg)), true
+}
+
+// sdkName returns the SDK an sdk dependency comes from, such as "flutter"
+// or "dart".
+func sdkName(meta PubDepsPackage) string {
+	if sdk, ok := meta.Description.(string); ok && sdk != "" {
+		return sdk
+	}
+	return "flutter"
+}
+
+// sdkDeps maps the direct SDK dependencies in deps to the SDK providing
+// them.
+func sdkDeps(deps *PubDeps) map[string]string {
+	if deps == nil {
+		return nil
+	}
+	var sdks map[string]string
+	for _, pkg := range deps.Packages {
+		if pkg.Source != "sdk" || !strings.HasPrefix(pkg.Dependency, "direct") {
+			continue
+		}
+		if sdks == nil {
+			sdks = make(map[string]string)
+		}
+		sdks[pkg.Name] = sdkName(pkg)
+	}
+	return sdks
+}
+
+// logUnknownSDKPackage reports an SDK dependency without a mapping.
+func logUnknownSDKPackage(from, pkg, sdk string) {
+	log.Printf("%s: %s is not a known %s SDK package; map it with \"# gazelle:%s %s <path>\"", from, pkg, sdk, DirectiveSDKPackage, pkg)
+}
@@ -0,0 +1,180 @@
+package flutter
+
+import (
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// srcsValue is a generated file list: a library's srcs, the files found
+// under lib/ or a glob over it in SrcsModeGlob, or a format test's srcs.
+// Merged into an existing rule, it never touches lists that already use
+// glob, so hand-maintained globs survive in either mode, and it keeps listed
+// files outside the directories it was collected from.
+type srcsValue struct {
+	// files are the collected source files, relative to the package
+	files []string
+
+	// glob replaces files in the BUILD file when set
+	glob *rule.GlobValue
+
+	// dirs are the package directories files were collected from. Entries
+	// of an existing list outside them, such as a dart_test.yaml next to
+	// pubspec.yaml, are hand-written.
+	dirs []string
+}
+
+// BzlExpr renders the value as a glob or a sorted list.
+func (v srcsValue) BzlExpr() bzl.Expr {
+	if v.glob != nil {
+		return v.glob.BzlExpr()
+	}
+	return rule.SortedStrings(v.files).BzlExpr()
+}
+
+// Merge keeps other if it calls glob and otherwise replaces it, carrying over
+// list entries marked "# keep".
+func (v srcsValue) Merge(other bzl.Expr) bzl.Expr {
+	if other == nil {
+		return v.BzlExpr()
+	}
+	if callsGlob(other) {
+		return other
+	}
+	extra := v.handWritten(other)
+	if v.glob != nil {
+		if len(extra) == 0 {
+			return v.BzlExpr()
+		}
+		return &bzl.BinaryExpr{X: v.BzlExpr(), Op: "+", Y: rule.SortedStrings(extra).BzlExpr()}
+	}
+	return rule.SortedStrings(append(append([]string{}, v.files...), extra...)).Merge(other)
+}
+
+// handWritten returns the entries of the list other outside v.dirs.
+func (v srcsValue) handWritten(other bzl.Expr) []string {
+	list, ok := other.(*bzl.ListExpr)
+	if !ok || len(v.dirs) == 0 {
+		return nil
+	}
+	var extra []string
+	for _, x := range list.List {
+		s, ok := x.(*bzl.StringExpr)
+		if !ok {
+			continue
+		}
+		owned := false
+		for _, dir := range v.dirs {
+			if strings.HasPrefix(s.Value, dir+"/") {
+				owned = true
+				break
+			}
+		}
+		if !owned {
+			extra = append(extra, s.Value)
+		}
+	}
+	return extra
+}
+
+// callsGlob reports whether expr contains a glob call.
+func callsGlob(expr bzl.Expr) bool {
+	found := false
+	bzl.Walk(expr, func(x bzl.Expr, _ []bzl.Expr) {
+		if call, ok := x.(*bzl.CallExpr); ok && callName(call) == "glob" {
+			found = true
+		}
+	})
+	return found
+}
+
+// librarySrcs returns the srcs value for the files collected under lib/ in
+// the package at rel. Glob mode excludes what collecting the list skips,
+// hidden and editor files and .bazelignore'd directories, adds extraExcludes
+// to the glob's excludes and falls back to the file list when a
+// flutter_exclude pattern can't be expressed as a Bazel glob exclude.
+func librarySrcs(files, extraExcludes []string, fc *FlutterConfig, rel string) srcsValue {
+	v := srcsValue{files: files, dirs: []string{"lib"}}
+	if fc.SrcsMode != SrcsModeGlob {
+		return v
+	}
+	excludes, ok := globExcludes(fc, rel, "lib")
+	if !ok {
+		log.Printf("//%s: %s patterns with character classes or \"?\" can't be glob excludes; listing srcs instead", rel, DirectiveExclude)
+		return v
+	}
+	for _, ignored := range ignoredFileGlobs {
+		excludes = append(excludes, "lib/**/"+ignored)
+	}
+	excludes = append(excludes, bazelIgnoreExcludes(fc, rel, "lib")...)
+	excludes = append(excludes, extraExcludes...)
+	sort.Strings(excludes)
+	v.glob = &rule.GlobValue{Patterns: []string{"lib/**"}, Excludes: excludes}
+	return v
+}
+
+// bazelIgnoreExcludes returns package-relative glob excludes for the
+// .bazelignore'd directories below dir, a directory of the package at rel.
+func bazelIgnoreExcludes(fc *FlutterConfig, rel, dir string) []string {
+	prefix := path.Join(rel, dir) + "/"
+	var excludes []string
+	for _, ignored := range fc.bazelIgnored {
+		if !strings.HasPrefix(ignored, prefix) {
+			continue
+		}
+		p := ignored
+		if rel != "" {
+			p = strings.TrimPrefix(ignored, rel+"/")
+		}
+		excludes = append(excludes, p+"/**")
+	}
+	return excludes
+}
+
+// globExcludes translates the flutter_exclude patterns that can match below
+// dir, a directory of the package at rel, into package-relative glob
+// excludes. It returns false if a pattern uses syntax Bazel globs lack.
+func globExcludes(fc *FlutterConfig, rel, dir string) ([]string, bool) {
+	seen := make(map[string]bool)
+	var excludes []string
+	for _, ex := range fc.Exclude {
+		var prefix string
+		switch {
+		case ex.Dir == "":
+			prefix = rel
+		case rel == ex.Dir:
+			prefix = ""
+		case strings.HasPrefix(rel, ex.Dir+"/"):
+			prefix = rel[len(ex.Dir)+1:]
+		default:
+			continue
+		}
+		for _, p := range relativeGlobs(ex.Pattern, prefix) {
+			first := splitPath(p)[0]
+			if ok, _ := path.Match(first, dir); first != "**" && !ok {
+				continue
+			}
+			if strings.ContainsAny(p, "?[\\") {
+				return nil, false
+			}
+			// Like flutter_exclude, an excluded directory excludes everything
+			// below it.
+			patterns := []string{p}
+			if !strings.HasSuffix(p, "**") {
+				patterns = append(patterns, p+"/**")
+			}
+			for _, exclude := range patterns {
+				if !seen[exclude] {
+					seen[exclude] = true
+					excludes = append(excludes, exclude)
+				}
+			}
+		}
+	}
+	sort.Strings(excludes)
+	return excludes, true
+}
@@ -0,0 +1,163 @@
+package flutter
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/merger"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+const srcsTestPubspec = "name: app\nenvironment:\n  flutter: \">=3.0.0\"\n"
+
+func TestGenerateRulesGlobsSrcsInGlobMode(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":            srcsTestPubspec,
+		"lib/main.dart":           "void main() {}\n",
+		"lib/generated/l10n.dart": "\n",
+		"lib/src/a.g.dart":        "\n",
+	})
+	args := generateArgs(t, dir, "apps/app")
+	fc := GetFlutterConfig(args.Config)
+	fc.SrcsMode = SrcsModeGlob
+	fc.Exclude = []ExcludePattern{
+		{Dir: "", Pattern: "apps/app/lib/generated"},
+		{Dir: "apps", Pattern: "**/*.g.dart"},
+		{Dir: "apps/app", Pattern: "test/**"},
+	}
+
+	fc.bazelIgnored = []string{"apps/app/lib/vendor", "apps/other/lib"}
+
+	lib := findRule((&flutterLang{}).GenerateRules(args).Gen, "flutter_library", "lib")
+	if lib == nil {
+		t.Fatal("no flutter_library generated")
+	}
+	want := `glob(
+    ["lib/**"],
+    exclude = [
+        "**/*.g.dart",
+        "**/*.g.dart/**",
+        "lib/**/#*#",
+        "lib/**/*.swo",
+        "lib/**/*.swp",
+        "lib/**/*~",
+        "lib/**/.*",
+        "lib/**/.*/**",
+        "lib/generated",
+        "lib/generated/**",
+        "lib/vendor/**",
+    ],
+)`
+	if got := bzl.FormatString(lib.Attr("srcs")); got != want {
+		t.Fatalf("srcs:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGenerateRulesListsSrcsForUntranslatableExcludes(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":   srcsTestPubspec,
+		"lib/main.dart":  "void main() {}\n",
+		"lib/main1.dart": "void main() {}\n",
+	})
+	args := generateArgs(t, dir, "app")
+	fc := GetFlutterConfig(args.Config)
+	fc.SrcsMode = SrcsModeGlob
+	fc.Exclude = []ExcludePattern{{Dir: "app", Pattern: "lib/main[0-9].dart"}}
+
+	lib := findRule((&flutterLang{}).GenerateRules(args).Gen, "flutter_library", "lib")
+	if got, want := lib.AttrStrings("srcs"), []string{"lib/main.dart"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("srcs: want %v got %v", want, got)
+	}
+}
+
+// mergedSrcs merges the library generated for dir into content and returns
+// its srcs.
+func mergedSrcs(t *testing.T, mode, content string) string {
+	t.Helper()
+	dir := writePackage(t, map[string]string{
+		"pubspec.yaml":  srcsTestPubspec,
+		"lib/main.dart": "void main() {}\n",
+		"lib/new.dart":  "\n",
+	})
+	args := generateArgs(t, dir, "app")
+	GetFlutterConfig(args.Config).SrcsMode = mode
+	f, err := rule.LoadData(filepath.Join(dir, "BUILD.bazel"), "app", []byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args.File = f
+	fl := &flutterLang{}
+	res := fl.GenerateRules(args)
+	merger.MergeFile(f, res.Empty, res.Gen, merger.PreResolve, fl.Kinds())
+	return bzl.FormatString(findRule(f.Rules, "flutter_library", "lib").Attr("srcs"))
+}
+
+func TestMergeLeavesExistingGlobAlone(t *testing.T) {
+	existing := `
+flutter_library(
+    name = "lib",
+    srcs = glob(["lib/**"]) + ["extra.dart"],
+    pubspec = "pubspec.yaml",
+)
+`
+	for _, mode := range []string{SrcsModeList, SrcsModeGlob} {
+		if got := mergedSrcs(t, mode, existing); got != `glob(["lib/**"]) + ["extra.dart"]` {
+			t.Errorf("%s mode rewrote an existing glob: %s", mode, got)
+		}
+	}
+}
+
+func TestMergeUpdatesListedSrcs(t *testing.T) {
+	existing := `
+flutter_library(
+    name = "lib",
+    srcs = [
+        "lib/gone.dart",
+        "lib/main.dart",
+        "lib/vendored.dart",  # keep
+    ],
+    pubspec = "pubspec.yaml",
+)
+`
+	got := mergedSrcs(t, SrcsModeList, existing)
+	for _, want := range []string{`"lib/main.dart"`, `"lib/new.dart"`, `"lib/vendored.dart",  # keep`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("merged srcs lack %s:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "gone.dart") {
+		t.Errorf("merged srcs kept a deleted file:\n%s", got)
+	}
+
+	if got := mergedSrcs(t, SrcsModeGlob, existing); !strings.HasPrefix(got, "glob(") {
+		t.Errorf("glob mode kept the file list: %s", got)
+	}
+}
+
+func TestMergeKeepsHandWrittenSrcsOutsideLib(t *testing.T) {
+	existing := `
+flutter_library(
+    name = "lib",
+    srcs = [
+        "dart_test.yaml",
+        "lib/gone.dart",
+        "lib/main.dart",
+    ],
+    pubspec = "pubspec.yaml",
+)
+`
+	want := `[
+    "dart_test.yaml",
+    "lib/main.dart",
+    "lib/new.dart",
+]`
+	if got := mergedSrcs(t, SrcsModeList, existing); got != want {
+		t.Errorf("list mode srcs:\n%s\nwant:\n%s", got, want)
+	}
+	if got := mergedSrcs(t, SrcsModeGlob, existing); !strings.HasSuffix(got, `+ ["dart_test.yaml"]`) {
+		t.Errorf("glob mode dropped the hand-written src: %s", got)
+	}
+}
@@ -0,0 +1,245 @@
+package flutter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// Values accepted by the -flutter_pub_use_repo flag
+const (
+	// UseRepoWarn logs the pub repositories missing from use_repo
+	UseRepoWarn = "warn"
+
+	// UseRepoPrint prints the use_repo call that adds the missing repositories
+	// to stderr
+	UseRepoPrint = "print"
+
+	// UseRepoFix adds the missing repositories to MODULE.bazel
+	UseRepoFix = "fix"
+)
+
+// useRepoFlag is the command-line flag selecting how missing pub
+// repositories are reported.
+const useRepoFlag = "flutter_pub_use_repo"
+
+// pubRepoTracker records the pub extension repositories generated labels
+// refer to, so those the root module doesn't import with use_repo can be
+// reported once every rule has been resolved. It is shared by every
+// FlutterConfig derived from the root one.
+type pubRepoTracker struct {
+	// mode is UseRepoWarn, UseRepoPrint or UseRepoFix
+	mode string
+
+	// moduleFile is the path of the root MODULE.bazel; empty when the
+	// repository doesn't use bzlmod, which disables tracking
+	moduleFile string
+
+	// rulesFlutter is the apparent name of rules_flutter in the root module
+	rulesFlutter string
+
+	// proxy is the variable holding the pub extension, if the module uses it
+	proxy string
+
+	// imported maps the repositories named in use_repo(pub, ...) to their
+	// apparent names
+	imported map[string]string
+
+	// missing holds referenced repositories absent from use_repo
+	missing map[string]bool
+
+	// declared holds the apparent names of the repositories the root module
+	// can see, whichever way it declares them
+	declared map[string]bool
+
+	// missingGit maps undeclared repositories of git dependencies to the
+	// package and source they are reported with
+	missingGit map[string]string
+}
+
+// configure records what the root module imports from the pub extension.
+func (t *pubRepoTracker) configure(filename string, m *moduleFile) {
+	if t == nil {
+		return
+	}
+	t.moduleFile = filename
+	t.rulesFlutter = m.rulesFlutterName()
+	t.proxy = m.extensionProxies["pub"]
+	t.imported = m.extensionRepos["pub"]
+	t.declared = m.repos
+}
+
+// apparentName returns the name the root module imports repo under, and
+// records repo as missing when it isn't imported at all.
+func (t *pubRepoTracker) apparentName(repo string) string {
+	if t == nil || t.moduleFile == "" {
+		return repo
+	}
+	if apparent, ok := t.imported[repo]; ok {
+		return apparent
+	}
+	if t.missing == nil {
+		t.missing = make(map[string]bool)
+	}
+	t.missing[repo] = true
+	return repo
+}
+
+// gitRepo records repo, the repository of a git dependency, as missing when
+// the root module doesn't declare it. The pub extension only provides hosted
+// packages, so these have to be declared by other means. source describes
+// the dependency for the report.
+func (t *pubRepoTracker) gitRepo(repo, source string) {
+	if t == nil || t.moduleFile == "" || t.declared[repo] {
+		return
+	}
+	if t.missingGit == nil {
+		t.missingGit = make(map[string]string)
+	}
+	if _, ok := t.missingGit[repo]; !ok {
+		t.missingGit[repo] = source
+	}
+}
+
+// missingRepos returns the sorted repositories missing from use_repo.
+func (t *pubRepoTracker) missingRepos() []string {
+	if t == nil {
+		return nil
+	}
+	repos := make([]string, 0, len(t.missing))
+	for repo := range t.missing {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+// report warns about the missing git dependency repositories, and warns
+// about, prints or adds the missing use_repo entries.
+func (t *pubRepoTracker) report() {
+	if t == nil {
+		return
+	}
+	gitRepos := make([]string, 0, len(t.missingGit))
+	for repo := range t.missingGit {
+		gitRepos = append(gitRepos, repo)
+	}
+	sort.Strings(gitRepos)
+	for _, repo := range gitRepos {
+		log.Printf("%s: %s; the pub extension only provides hosted packages, so @%s must be declared separately (for example with git_repository)", t.moduleFile, t.missingGit[repo], repo)
+	}
+
+	repos := t.missingRepos()
+	if len(repos) == 0 {
+		return
+	}
+
+	switch t.mode {
+	case UseRepoPrint:
+		// stdout carries the BUILD files of -mode=print and -mode=diff.
+		fmt.Fprintf(os.Stderr, "%s: generated deps need these pub repositories; add:\n\n%s\n", t.moduleFile, t.useRepoSnippet(repos))
+	case UseRepoFix:
+		if err := t.fix(repos); err != nil {
+			log.Printf("%s: adding pub repositories to use_repo: %v", t.moduleFile, err)
+			return
+		}
+		log.Printf("%s: added %s to use_repo(%s, ...)", t.moduleFile, strings.Join(repos, ", "), t.proxyName())
+	default:
+		log.Printf("%s: use_repo(%s, ...) is missing %s, which generated deps refer to; rerun with -%s=print or -%s=fix to update it", t.moduleFile, t.proxyName(), strings.Join(repos, ", "), useRepoFlag, useRepoFlag)
+	}
+}
+
+// proxyName returns the variable the pub extension is, or should be, bound to.
+func (t *pubRepoTracker) proxyName() string {
+	if t.proxy != "" {
+		return t.proxy
+	}
+	return "pub"
+}
+
+// useRepoStmts returns the statements importing repos, declaring the pub
+// extension first if the module doesn't use it yet.
+func (t *pubRepoTracker) useRepoStmts(repos []string) []bzl.Expr {
+	var stmts []bzl.Expr
+	if t.proxy == "" {
+		stmts = append(stmts, &bzl.AssignExpr{
+			LHS: &bzl.Ident{Name: t.proxyName()},
+			Op:  "=",
+			RHS: &bzl.CallExpr{
+				X: &bzl.Ident{Name: "use_extension"},
+				List: []bzl.Expr{
+					&bzl.StringExpr{Value: "@" + t.rulesFlutter + "//flutter:extensions.bzl"},
+					&bzl.StringExpr{Value: "pub"},
+				},
+			},
+		})
+	}
+	call := &bzl.CallExpr{X: &bzl.Ident{Name: "use_repo"}, List: []bzl.Expr{&bzl.Ident{Name: t.proxyName()}}}
+	for _, repo := range repos {
+		call.List = append(call.List, &bzl.StringExpr{Value: repo})
+	}
+	return append(stmts, call)
+}
+
+// useRepoSnippet formats the statements that import repos.
+func (t *pubRepoTracker) useRepoSnippet(repos []string) string {
+	return string(bzl.Format(&bzl.File{Type: bzl.TypeModule, Stmt: t.useRepoStmts(repos)}))
+}
+
+// fix adds repos to the last use_repo call for the pub extension in the
+// root MODULE.bazel, or appends a new one.
+func (t *pubRepoTracker) fix(repos []string) error {
+	data, err := os.ReadFile(t.moduleFile)
+	if err != nil {
+		return err
+	}
+	f, err := bzl.ParseModule(t.moduleFile, data)
+	if err != nil {
+		return err
+	}
+
+	var last *bzl.CallExpr
+	if t.proxy != "" {
+		for _, stmt := range f.Stmt {
+			call, ok := stmt.(*bzl.CallExpr)
+			if !ok || callName(call) != "use_repo" || len(call.List) == 0 {
+				continue
+			}
+			if id, ok := call.List[0].(*bzl.Ident); ok && id.Name == t.proxy {
+				last = call
+			}
+		}
+	}
+	if last != nil {
+		// Positional arguments go before keyword ones so formatting sorts
+		// them together with the existing repositories.
+		i := len(last.List)
+		for i > 1 {
+			if _, ok := last.List[i-1].(*bzl.AssignExpr); !ok {
+				break
+			}
+			i--
+		}
+		var added []bzl.Expr
+		for _, repo := range repos {
+			added = append(added, &bzl.StringExpr{Value: repo})
+		}
+		last.List = append(last.List[:i], append(added, last.List[i:]...)...)
+	} else {
+		f.Stmt = append(f.Stmt, t.useRepoStmts(repos)...)
+	}
+
+	// Formatting also sorts use_repo arguments.
+	return os.WriteFile(t.moduleFile, bzl.Format(f), 0o644)
+}
+
+// AfterResolvingDeps reports pub repositories missing from the root module's
+// use_repo once every rule has been resolved.
+func (fl *flutterLang) AfterResolvingDeps(ctx context.Context) {
+	fl.pubRepos.report()
+}
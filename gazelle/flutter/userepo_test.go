@@ -0,0 +1,129 @@
+package flutter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const useRepoTestModule = `bazel_dep(name = "rules_flutter", version = "0.2.1")
+
+pub = use_extension("@rules_flutter//flutter:extensions.bzl", "pub")
+use_repo(
+    pub,
+    "pub_http",
+    coll = "pub_collection",
+)
+`
+
+func newTestTracker(t *testing.T, module string) *pubRepoTracker {
+	t.Helper()
+	root := writePackage(t, map[string]string{"MODULE.bazel": module})
+	m, err := loadModuleFile(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := &pubRepoTracker{mode: UseRepoWarn}
+	tracker.configure(filepath.Join(root, "MODULE.bazel"), m)
+	return tracker
+}
+
+func TestPubRepoTrackerRecordsMissingRepos(t *testing.T) {
+	tracker := newTestTracker(t, useRepoTestModule)
+	fc := &FlutterConfig{pubRepos: tracker}
+
+	for pkg, want := range map[string]string{
+		"http":       "@pub_http//:http",
+		"collection": "@coll//:collection",
+		"meta":       "@pub_meta//:meta",
+		"args":       "@pub_args//:args",
+	} {
+		if got := hostedDependencyLabel(pkg, "", fc); got != want {
+			t.Errorf("hostedDependencyLabel(%q) = %q, want %q", pkg, got, want)
+		}
+	}
+	if got, want := tracker.missingRepos(), []string{"pub_args", "pub_meta"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("missingRepos: want %v got %v", want, got)
+	}
+}
+
+func TestPubRepoTrackerIgnoresWorkspaceRepos(t *testing.T) {
+	tracker := &pubRepoTracker{mode: UseRepoWarn}
+	if got := tracker.apparentName("pub_meta"); got != "pub_meta" {
+		t.Fatalf("apparentName = %q", got)
+	}
+	if got := tracker.missingRepos(); len(got) != 0 {
+		t.Fatalf("repositories tracked without a MODULE.bazel: %v", got)
+	}
+}
+
+func TestPubRepoTrackerFixExtendsUseRepo(t *testing.T) {
+	tracker := newTestTracker(t, useRepoTestModule)
+	tracker.mode = UseRepoFix
+	tracker.apparentName("pub_meta")
+	tracker.apparentName("pub_args")
+	tracker.report()
+
+	got, err := os.ReadFile(tracker.moduleFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `bazel_dep(name = "rules_flutter", version = "0.2.1")
+
+pub = use_extension("@rules_flutter//flutter:extensions.bzl", "pub")
+use_repo(
+    pub,
+    "pub_args",
+    "pub_http",
+    "pub_meta",
+    coll = "pub_collection",
+)
+`
+	if string(got) != want {
+		t.Fatalf("MODULE.bazel after fix:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPubRepoTrackerDeclaresMissingExtension(t *testing.T) {
+	tracker := newTestTracker(t, `bazel_dep(name = "rules_flutter", version = "0.2.1", repo_name = "flutter_rules")
+`)
+	tracker.apparentName("pub_meta")
+
+	want := `pub = use_extension("@flutter_rules//flutter:extensions.bzl", "pub")
+use_repo(pub, "pub_meta")
+`
+	if got := tracker.useRepoSnippet(tracker.missingRepos()); got != want {
+		t.Fatalf("useRepoSnippet:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPubRepoTrackerReportsUndeclaredGitRepos(t *testing.T) {
+	tracker := newTestTracker(t, useRepoTestModule+`
+git_repository = use_repo_rule("@bazel_tools//tools/build_defs/repo:git.bzl", "git_repository")
+
+git_repository(
+    name = "pub_forked_widgets",
+    remote = "https://github.com/example/widgets.git",
+)
+`)
+	fc := &FlutterConfig{pubRepos: tracker}
+
+	for _, name := range []string{"forked_widgets", "patched_http"} {
+		pkg := PubDepsPackage{Name: name, Source: "git", Description: map[string]interface{}{"url": "https://github.com/example/" + name + ".git"}}
+		if got, want := gitDependencyLabel(pkg, fc, "app"), "@pub_"+name+"//:"+name; got != want {
+			t.Errorf("gitDependencyLabel(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	var got []string
+	for repo := range tracker.missingGit {
+		got = append(got, repo)
+	}
+	if want := []string{"pub_patched_http"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("undeclared git repositories: want %v got %v", want, got)
+	}
+	if got := tracker.missingRepos(); len(got) != 0 {
+		t.Fatalf("git repositories recorded as missing from use_repo: %v", got)
+	}
+}
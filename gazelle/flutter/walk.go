@@ -0,0 +1,219 @@
+package flutter
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+)
+
+// sourceFiles are the files collected from a package's lib/ directory,
+// relative to the package.
+type sourceFiles struct {
+	// Dart lists the .dart files
+	Dart []string
+
+	// Assets lists every other file: images, fonts, JSON and the like
+	Assets []string
+}
+
+// All returns the Dart sources and assets in one sorted list.
+func (s sourceFiles) All() []string {
+	all := append(append([]string{}, s.Dart...), s.Assets...)
+	sort.Strings(all)
+	return all
+}
+
+// collectSourceFiles walks the lib/ directory of the package in baseDir and
+// sorts the files found into Dart sources and assets. Subpackages are left
+// out; see walkPackageDir.
+func collectSourceFiles(baseDir string, buildFileNames []string, fc *FlutterConfig, rel string) sourceFiles {
+	var srcs sourceFiles
+	for _, f := range walkPackageDir(filepath.Join(baseDir, "lib"), baseDir, buildFileNames, fc, rel) {
+		if strings.HasSuffix(f, ".dart") {
+			srcs.Dart = append(srcs.Dart, f)
+		} else {
+			srcs.Assets = append(srcs.Assets, f)
+		}
+	}
+	sort.Strings(srcs.Dart)
+	sort.Strings(srcs.Assets)
+	return srcs
+}
+
+// walkPackageDir recursively walks a directory of the package in baseDir and
+// returns relative paths to all files not excluded by flutter_exclude or
+// .bazelignore. rel is the repository-relative path of baseDir. The walk
+// stops at subpackages, directories with one of buildFileNames or their own
+// pubspec.yaml, whose files labels in this package can't refer to; nothing
+// is returned when dir is one itself.
+func walkPackageDir(dir string, baseDir string, buildFileNames []string, fc *FlutterConfig, rel string) []string {
+	if isSubpackage(dir, buildFileNames) {
+		return nil
+	}
+	return walkDirFiltered(dir, baseDir, packageFilter(baseDir, buildFileNames, fc, rel))
+}
+
+// packageFilter returns the walkDirFiltered predicate of walkPackageDir.
+func packageFilter(baseDir string, buildFileNames []string, fc *FlutterConfig, rel string) func(relPath string, info os.FileInfo) bool {
+	excluded := fc.excludeFilter(rel)
+	return func(relPath string, info os.FileInfo) bool {
+		if excluded != nil && excluded(relPath, info) {
+			return true
+		}
+		return info.IsDir() && isSubpackage(filepath.Join(baseDir, relPath), buildFileNames)
+	}
+}
+
+// isSubpackage reports whether dir holds a BUILD file named one of
+// buildFileNames, or the default names when there are none, or a
+// pubspec.yaml.
+func isSubpackage(dir string, buildFileNames []string) bool {
+	if len(buildFileNames) == 0 {
+		buildFileNames = config.DefaultValidBuildFileNames
+	}
+	for _, name := range append([]string{"pubspec.yaml"}, buildFileNames...) {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// walkDirFiltered walks a directory with a skip predicate, which receives
+// paths relative to baseDir; skipped directories are not descended into.
+//
+// Hidden files and directories (.DS_Store, .dart_tool, editor state) and
+// editor backups are never collected. Symlinks are followed, since Bazel
+// follows them too, except those leading back into a directory being walked.
+// Unreadable entries and broken symlinks are reported and skipped.
+func walkDirFiltered(dir string, baseDir string, skip func(relPath string, info os.FileInfo) bool) []string {
+	w := &dirWalker{
+		baseDir: baseDir,
+		skip:    skip,
+		parents: make(map[string]bool),
+	}
+	w.walk(dir)
+	return w.files
+}
+
+// dirWalker holds the state of a walkDirFiltered call.
+type dirWalker struct {
+	baseDir string
+	skip    func(relPath string, info os.FileInfo) bool
+	files   []string
+
+	// parents holds the resolved paths of the directories being walked, so
+	// that symlinks pointing back into them aren't followed forever.
+	parents map[string]bool
+}
+
+func (w *dirWalker) walk(dir string) {
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		log.Printf("%s: %v", dir, err)
+		return
+	}
+	if w.parents[real] {
+		log.Printf("%s: symlink loops back to %s; not following it", dir, real)
+		return
+	}
+	w.parents[real] = true
+	defer delete(w.parents, real)
+
+	// ReadDir returns the entries it could read along with the error.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("%s: %v", dir, err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if isIgnoredFileName(name) {
+			continue
+		}
+		p := filepath.Join(dir, name)
+		info, err := os.Stat(p)
+		if err != nil {
+			if entry.Type()&os.ModeSymlink != 0 {
+				log.Printf("%s: broken symlink: %v", p, err)
+			} else {
+				log.Printf("%s: %v", p, err)
+			}
+			continue
+		}
+		relPath, err := filepath.Rel(w.baseDir, p)
+		if err != nil {
+			log.Printf("%s: %v", p, err)
+			continue
+		}
+		if w.skip != nil && w.skip(relPath, info) {
+			continue
+		}
+		switch {
+		case info.IsDir():
+			w.walk(p)
+		case info.Mode().IsRegular():
+			w.files = append(w.files, relPath)
+		}
+	}
+}
+
+// isIgnoredFileName reports whether a file or directory name belongs to
+// hidden or editor state that is never part of a package: dotfiles such as
+// .DS_Store and .dart_tool, Vim swap files and Emacs backup and lock files.
+func isIgnoredFileName(name string) bool {
+	return strings.HasPrefix(name, ".") ||
+		strings.HasSuffix(name, "~") ||
+		strings.HasSuffix(name, ".swp") ||
+		strings.HasSuffix(name, ".swo") ||
+		(len(name) > 1 && strings.HasPrefix(name, "#") && strings.HasSuffix(name, "#"))
+}
+
+// ignoredFileGlobs are the Bazel glob patterns matching the names
+// isIgnoredFileName rejects, and everything below hidden directories.
+var ignoredFileGlobs = []string{".*", ".*/**", "*~", "*.swp", "*.swo", "#*#"}
+
+// loadBazelIgnore reads the directories listed in repoRoot's .bazelignore,
+// slash-separated and relative to repoRoot. Like Bazel, it takes one path
+// per line and ignores comments.
+func loadBazelIgnore(repoRoot string) []string {
+	filename := filepath.Join(repoRoot, ".bazelignore")
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		log.Printf("%s: %v", filename, err)
+		return nil
+	}
+	defer file.Close()
+
+	var ignored []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry, _, _ := strings.Cut(scanner.Text(), "#")
+		entry = strings.Trim(strings.TrimSpace(filepath.ToSlash(entry)), "/")
+		if entry != "" {
+			ignored = append(ignored, path.Clean(entry))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("%s: %v", filename, err)
+	}
+	return ignored
+}
+
+// isBazelIgnored reports whether the repository-relative path p lies in a
+// directory listed in .bazelignore.
+func (fc *FlutterConfig) isBazelIgnored(p string) bool {
+	for _, dir := range fc.bazelIgnored {
+		if p == dir || strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package flutter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCollectSourceFilesSortsDartFromAssets(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"lib/main.dart":          "",
+		"lib/src/widget.dart":    "",
+		"lib/assets/logo.png":    "",
+		"lib/l10n/app_en.arb":    "",
+		"lib/.DS_Store":          "",
+		"lib/.main.dart.swp":     "",
+		"lib/main.dart.swp":      "",
+		"lib/main.dart~":         "",
+		"lib/#main.dart#":        "",
+		"lib/.dart_tool/x.dart":  "",
+		"lib/src/.hidden/y.dart": "",
+	})
+
+	got := collectSourceFiles(dir, nil, &FlutterConfig{}, "")
+	want := sourceFiles{
+		Dart:   []string{"lib/main.dart", "lib/src/widget.dart"},
+		Assets: []string{"lib/assets/logo.png", "lib/l10n/app_en.arb"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %+v, got %+v", want, got)
+	}
+	if all := got.All(); !reflect.DeepEqual(all, []string{
+		"lib/assets/logo.png", "lib/l10n/app_en.arb", "lib/main.dart", "lib/src/widget.dart",
+	}) {
+		t.Errorf("All: %v", all)
+	}
+}
+
+func TestCollectSourceFilesHonorsBazelIgnore(t *testing.T) {
+	root := writePackage(t, map[string]string{
+		".bazelignore":                  "# Vendored checkout\napp/lib/vendor/\n\n/app/lib/tmp # scratch\n",
+		"app/lib/main.dart":             "",
+		"app/lib/vendor/pkg/lib/a.dart": "",
+		"app/lib/tmp/b.dart":            "",
+		"app/lib/vendored_widgets.dart": "",
+	})
+	fc := &FlutterConfig{bazelIgnored: loadBazelIgnore(root)}
+	if want := []string{"app/lib/vendor", "app/lib/tmp"}; !reflect.DeepEqual(fc.bazelIgnored, want) {
+		t.Fatalf("loadBazelIgnore: want %v, got %v", want, fc.bazelIgnored)
+	}
+
+	got := collectSourceFiles(filepath.Join(root, "app"), nil, fc, "app").Dart
+	want := []string{"lib/main.dart", "lib/vendored_widgets.dart"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
+
+func TestWalkDirFollowsSymlinksWithoutLooping(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"lib/main.dart":        "",
+		"shared/lib/util.dart": "",
+	})
+	for link, target := range map[string]string{
+		"lib/shared":      "../shared/lib",
+		"lib/util.dart":   "../shared/lib/util.dart",
+		"lib/loop":        ".",
+		"lib/broken.dart": "missing.dart",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Skipf("symlinks unsupported: %v", err)
+		}
+	}
+
+	got := collectSourceFiles(dir, nil, &FlutterConfig{}, "").Dart
+	want := []string{"lib/main.dart", "lib/shared/util.dart", "lib/util.dart"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
+
+func TestWalkPackageDirStopsAtSubpackages(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"lib/main.dart":            "",
+		"lib/sub/BUILD.bazel":      "",
+		"lib/sub/a.dart":           "",
+		"lib/nested/pubspec.yaml":  "name: nested\n",
+		"lib/nested/lib/b.dart":    "",
+		"test/main_test.dart":      "",
+		"test/fixtures/BUILD":      "",
+		"test/fixtures/data.json":  "",
+		"web/index.html":           "",
+		"web/wasm/BUILD.bazel":     "",
+		"web/wasm/module.wasm":     "",
+		"android/BUILD.bazel":      "",
+		"android/app/build.gradle": "",
+	})
+	fc := &FlutterConfig{}
+
+	if got, want := collectSourceFiles(dir, nil, fc, "").All(), []string{"lib/main.dart"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("lib: want %v, got %v", want, got)
+	}
+	if got, want := walkPackageDir(filepath.Join(dir, "test"), dir, nil, fc, ""), []string{"test/main_test.dart"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("test: want %v, got %v", want, got)
+	}
+	if got, want := platformOverlayFiles(dir, "web", nil, fc, ""), []string{"web/index.html"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("web: want %v, got %v", want, got)
+	}
+	if got := platformOverlayFiles(dir, "android", nil, fc, ""); len(got) != 0 {
+		t.Errorf("android: want no files, got %v", got)
+	}
+}
@@ -4,11 +4,11 @@ go 1.24.0
 
 require (
 	github.com/bazelbuild/bazel-gazelle v0.36.0
+	github.com/bazelbuild/buildtools v0.0.0-20240313121412-66c605173954
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/bazelbuild/buildtools v0.0.0-20240313121412-66c605173954 // indirect
 	golang.org/x/mod v0.16.0 // indirect
 	golang.org/x/sys v0.18.0 // indirect
 	golang.org/x/tools/go/vcs v0.1.0-deprecated // indirect